@@ -48,6 +48,10 @@ func main() {
 	}
 
 	r := gin.Default()
+	// 只有来自可信代理的连接才采信 X-Forwarded-For / X-Real-IP，HTTP 与 WS 都经 c.ClientIP() 取地址
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 	// 静态页面（内嵌）
 	r.GET("/", serveEmbedded("web/index.html"))
 	r.GET("/admin", serveEmbedded("web/admin.html"))
@@ -55,11 +59,16 @@ func main() {
 	r.GET("/withdraw", serveEmbedded("web/withdraw.html"))
 
 	r.GET("/ws", func(c *gin.Context) {
-		srv.HandleWS(c.Writer, c.Request)
+		srv.HandleWS(c.Writer, c.Request, c.ClientIP())
+	})
+	r.GET("/ws/screen", func(c *gin.Context) {
+		srv.HandleScreenWS(c.Writer, c.Request)
 	})
 
-	api := r.Group("/api")
+	api := r.Group("/api", srv.CORS())
 	{
+		// 预检请求由 CORS 中间件直接应答
+		api.OPTIONS("/*path", func(c *gin.Context) {})
 		api.GET("/assets", srv.GetAssets)
 
 		auth := api.Group("/auth")
@@ -73,9 +82,11 @@ func main() {
 		api.GET("/user/withdraws", srv.AuthRequired(), srv.ListWithdraws)
 		api.GET("/rounds/current", srv.GetCurrentRound)
 		api.GET("/game/state", srv.AuthRequired(), srv.GetGameState)
+		api.GET("/game/events", srv.AuthRequired(), srv.GameEvents)
 		api.POST("/game/click", srv.AuthRequired(), srv.Click)
 		api.GET("/game/result", srv.AuthRequired(), srv.GetResult)
 		api.GET("/game/reveal", srv.AuthRequired(), srv.GetGameReveal)
+		api.POST("/game/checkin", srv.AuthRequired(), srv.Checkin)
 
 		remote := api.Group("/remote")
 		remote.POST("/register", srv.RemoteRegister)
@@ -87,15 +98,54 @@ func main() {
 		admin.POST("/rounds", srv.CreateRound)
 		admin.GET("/rounds", srv.ListRounds)
 		admin.POST("/rounds/:id/whitelist", srv.AddWhitelist)
+		admin.GET("/rounds/:id/whitelist", srv.ListWhitelist)
+		admin.POST("/rounds/:id/whitelist/import", srv.ImportWhitelistCSV)
+		admin.POST("/rounds/:id/whitelist/remove", srv.RemoveWhitelist)
+		admin.DELETE("/rounds/:id/whitelist/:uid", srv.RemoveWhitelistUser)
+		admin.POST("/rounds/:id/whitelist/roster", srv.AddWhitelistFromRoster)
+		admin.GET("/rounds/:id/checkin", srv.GetCheckin)
+		admin.POST("/rounds/:id/checkin", srv.OpenCheckin)
+		admin.DELETE("/rounds/:id/checkin", srv.CloseCheckin)
 		admin.POST("/rounds/:id/lock", srv.LockRound)
 		admin.POST("/rounds/:id/clear", srv.ClearRound)
 		admin.POST("/rounds/:id/start", srv.StartRound)
 		admin.POST("/rounds/:id/draw", srv.DrawRound)
+		admin.PATCH("/rounds/:id", srv.PatchRound)
 		admin.DELETE("/rounds/:id", srv.DeleteRound)
 		admin.GET("/rounds/:id/results", srv.GetRoundResults)
 		admin.GET("/rounds/:id/leaderboard", srv.GetLeaderboard)
+		admin.GET("/rounds/:id/teams", srv.GetRoundTeams)
 		admin.GET("/rounds/:id/export", srv.ExportRound)
+		admin.GET("/rounds/:id/suspects", srv.GetRoundSuspects)
+		admin.POST("/rounds/:id/exclusions", srv.ExcludeRoundUsers)
+		admin.DELETE("/rounds/:id/exclusions/:uid", srv.RemoveRoundExclusion)
+		admin.POST("/rounds/:id/adjustments", srv.AdjustRoundScore)
+		admin.POST("/rounds/:id/pause", srv.PauseRound)
+		admin.POST("/rounds/:id/resume", srv.ResumeRound)
+		admin.POST("/rounds/:id/extend", srv.ExtendRound)
+		admin.POST("/rounds/:id/end", srv.EndRoundEarly)
+		admin.POST("/rounds/:id/abort", srv.AbortRound)
+		admin.POST("/rounds/:id/clone", srv.CloneRound)
+		admin.GET("/rounds/:id/timeline", srv.GetRoundTimeline)
+		admin.GET("/rounds/:id/adjustments", srv.GetRoundAdjustments)
+		admin.GET("/round_templates", srv.ListRoundTemplates)
+		admin.POST("/round_templates", srv.SaveRoundTemplate)
+		admin.POST("/round_templates/:id/apply", srv.ApplyRoundTemplate)
+		admin.DELETE("/round_templates/:id", srv.DeleteRoundTemplate)
+		admin.GET("/roster", srv.ListRoster)
+		admin.GET("/roster/facets", srv.GetRosterFacets)
+		admin.POST("/roster/import", srv.ImportRoster)
+		admin.DELETE("/roster/:uid", srv.DeleteRosterEntry)
+		admin.GET("/agenda", srv.ListAgenda)
+		admin.POST("/agenda", srv.ScheduleRound)
+		admin.POST("/agenda/:id/retry", srv.RetryAgendaItem)
+		admin.DELETE("/agenda/:id", srv.DeleteAgendaItem)
 		admin.GET("/online_users", srv.GetOnlineUsers)
+		admin.POST("/announcements", srv.Announce)
+		admin.GET("/danmaku", srv.GetDanmakuAdmin)
+		admin.POST("/danmaku", srv.UpdateDanmakuAdmin)
+		admin.POST("/danmaku/mute", srv.MuteDanmakuUser)
+		admin.DELETE("/danmaku/:id", srv.DeleteDanmaku)
 		admin.GET("/metrics", srv.GetMetrics)
 		admin.GET("/award_batches", srv.ListAwardBatches)
 		admin.POST("/award_batches/:id/confirm", srv.ConfirmAward)
@@ -45,6 +45,8 @@ CREATE TABLE `award_details` (
   `created_at` datetime NOT NULL,
   `base_amount` bigint NOT NULL DEFAULT '0',
   `lucky_amount` bigint NOT NULL DEFAULT '0',
+  `team` varchar(64) NOT NULL DEFAULT '',
+  `team_amount` bigint NOT NULL DEFAULT '0',
   PRIMARY KEY (`id`) USING BTREE,
   KEY `idx_batch` (`batch_id`) USING BTREE,
   KEY `idx_user` (`user_id`) USING BTREE
@@ -66,6 +68,133 @@ CREATE TABLE `click_events` (
   KEY `idx_round_user` (`round_id`,`user_id`) USING BTREE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
 
+-- ----------------------------
+-- Table structure for roster_employees
+-- ----------------------------
+DROP TABLE IF EXISTS `roster_employees`;
+CREATE TABLE `roster_employees` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` bigint NOT NULL,
+  `phone` varchar(20) NOT NULL,
+  `name` varchar(32) NOT NULL DEFAULT '',
+  `department` varchar(64) NOT NULL DEFAULT '',
+  `employee_no` varchar(32) NOT NULL DEFAULT '',
+  `operator` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE KEY `uniq_user` (`user_id`) USING BTREE,
+  KEY `idx_department` (`department`) USING BTREE,
+  KEY `idx_employee_no` (`employee_no`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for roster_tags
+-- ----------------------------
+DROP TABLE IF EXISTS `roster_tags`;
+CREATE TABLE `roster_tags` (
+  `user_id` bigint NOT NULL,
+  `tag` varchar(32) NOT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`user_id`,`tag`) USING BTREE,
+  KEY `idx_tag` (`tag`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_adjustments
+-- ----------------------------
+DROP TABLE IF EXISTS `round_adjustments`;
+CREATE TABLE `round_adjustments` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `round_id` bigint NOT NULL,
+  `user_id` bigint NOT NULL,
+  `kind` varchar(16) NOT NULL,
+  `delta` int NOT NULL DEFAULT '0',
+  `reason` varchar(255) NOT NULL DEFAULT '',
+  `operator` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  KEY `idx_round` (`round_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_agenda
+-- ----------------------------
+DROP TABLE IF EXISTS `round_agenda`;
+CREATE TABLE `round_agenda` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `round_id` bigint NOT NULL,
+  `lock_at_ms` bigint NOT NULL,
+  `start_at_ms` bigint NOT NULL,
+  `countdown_sec` int NOT NULL DEFAULT '3',
+  `auto_draw` tinyint NOT NULL DEFAULT '0',
+  `auto_confirm` tinyint NOT NULL DEFAULT '0',
+  `status` varchar(16) NOT NULL DEFAULT 'SCHEDULED',
+  `last_step` varchar(16) NOT NULL DEFAULT '',
+  `last_error` varchar(255) NOT NULL DEFAULT '',
+  `operator` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE KEY `uniq_round` (`round_id`) USING BTREE,
+  KEY `idx_status_start` (`status`,`start_at_ms`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_checkins
+-- ----------------------------
+DROP TABLE IF EXISTS `round_checkins`;
+CREATE TABLE `round_checkins` (
+  `round_id` bigint NOT NULL,
+  `user_id` bigint NOT NULL,
+  `ip` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`round_id`,`user_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_exclusions
+-- ----------------------------
+DROP TABLE IF EXISTS `round_exclusions`;
+CREATE TABLE `round_exclusions` (
+  `round_id` bigint NOT NULL,
+  `user_id` bigint NOT NULL,
+  `reason` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`round_id`,`user_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_status_history
+-- ----------------------------
+DROP TABLE IF EXISTS `round_status_history`;
+CREATE TABLE `round_status_history` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `round_id` bigint NOT NULL,
+  `from_status` varchar(32) NOT NULL DEFAULT '',
+  `to_status` varchar(32) NOT NULL,
+  `actor` varchar(64) NOT NULL DEFAULT '',
+  `reason` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  KEY `idx_round` (`round_id`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
+-- ----------------------------
+-- Table structure for round_templates
+-- ----------------------------
+DROP TABLE IF EXISTS `round_templates`;
+CREATE TABLE `round_templates` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `name` varchar(64) NOT NULL,
+  `config` json NOT NULL,
+  `operator` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`id`) USING BTREE,
+  UNIQUE KEY `uniq_name` (`name`) USING BTREE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
+
 -- ----------------------------
 -- Table structure for round_whitelist
 -- ----------------------------
@@ -97,6 +226,7 @@ CREATE TABLE `rounds` (
   `status` varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL,
   `start_at_ms` bigint NOT NULL DEFAULT '0',
   `end_at_ms` bigint NOT NULL DEFAULT '0',
+  `paused_at_ms` bigint NOT NULL DEFAULT '0',
   `seed` int unsigned NOT NULL DEFAULT '0',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
@@ -109,6 +239,16 @@ CREATE TABLE `rounds` (
   `base_ratio` int NOT NULL DEFAULT '60',
   `tail_top_n` int NOT NULL DEFAULT '3',
   `rank_segments` int NOT NULL DEFAULT '10',
+  `leaderboard_interval_ms` int NOT NULL DEFAULT '1000',
+  `leaderboard_top_n` int NOT NULL DEFAULT '10',
+  `abort_reason` varchar(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL DEFAULT '',
+  `template_id` bigint NOT NULL DEFAULT '0',
+  `team_mode` varchar(16) NOT NULL DEFAULT '',
+  `team_count` int NOT NULL DEFAULT '0',
+  `team_ratio` int NOT NULL DEFAULT '0',
+  `team_top_n` int NOT NULL DEFAULT '0',
+  `late_join` varchar(16) NOT NULL DEFAULT 'ALLOW',
+  `late_join_sec` int NOT NULL DEFAULT '0',
   PRIMARY KEY (`id`) USING BTREE,
   KEY `idx_status` (`status`) USING BTREE
 ) ENGINE=InnoDB AUTO_INCREMENT=4 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
@@ -151,6 +291,7 @@ CREATE TABLE `users` (
   `is_admin` tinyint NOT NULL DEFAULT '0',
   `created_at` datetime NOT NULL,
   `updated_at` datetime NOT NULL,
+  `department` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL DEFAULT '',
   PRIMARY KEY (`id`) USING BTREE,
   UNIQUE KEY `phone` (`phone`) USING BTREE
 ) ENGINE=InnoDB AUTO_INCREMENT=203 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci ROW_FORMAT=DYNAMIC;
@@ -26,6 +26,13 @@ type Config struct {
 	ClickGraceMS                   int
 	MinSpeedMult                   float64
 	TimeSkewMS                     int
+	ClickTimeToleranceMS           int
+	ClickMaxRTTMS                  int
+	ClickRatePerSec                float64
+	ClickRateBurst                 float64
+	ClickIPRatePerSec              float64
+	ClickIPRateBurst               float64
+	ClickRateLimitRedis            bool
 	RuntimeCacheUsers              int
 	RuntimeCacheSlices             int
 	ClickStreamEnabled             bool
@@ -50,6 +57,14 @@ type Config struct {
 	WithdrawWorkerEnabled          bool
 	WithdrawEnabled                bool
 	RemoteAPIKey                   string
+	ScreenKey                      string
+	DanmakuEnabled                 bool
+	DanmakuIntervalMS              int
+	DanmakuMaxLen                  int
+	DanmakuBlocklist               []string
+	AllowedOrigins                 []string
+	TrustedProxies                 []string
+	DevMode                        bool
 }
 
 func Load() Config {
@@ -72,6 +87,13 @@ func Load() Config {
 		ClickGraceMS:                   getEnvInt("CLICK_GRACE_MS", 15000),
 		MinSpeedMult:                   getEnvFloat("MIN_SPEED_MULT", 0.2),
 		TimeSkewMS:                     getEnvInt("TIME_SKEW_MS", 400),
+		ClickTimeToleranceMS:           getEnvInt("CLICK_TIME_TOLERANCE_MS", 150),
+		ClickMaxRTTMS:                  getEnvInt("CLICK_MAX_RTT_MS", 300),
+		ClickRatePerSec:                getEnvFloat("CLICK_RATE_PER_SEC", 20),
+		ClickRateBurst:                 getEnvFloat("CLICK_RATE_BURST", 40),
+		ClickIPRatePerSec:              getEnvFloat("CLICK_IP_RATE_PER_SEC", 500),
+		ClickIPRateBurst:               getEnvFloat("CLICK_IP_RATE_BURST", 1000),
+		ClickRateLimitRedis:            getEnvBool("CLICK_RATE_LIMIT_REDIS", false),
 		RuntimeCacheUsers:              getEnvInt("RUNTIME_CACHE_USERS", 2000),
 		RuntimeCacheSlices:             getEnvInt("RUNTIME_CACHE_SLICES", 4),
 		ClickStreamEnabled:             getEnvBool("CLICK_STREAM_ENABLED", true),
@@ -96,6 +118,11 @@ func Load() Config {
 		WithdrawWorkerEnabled:          getEnvBool("WITHDRAW_WORKER_ENABLED", false),
 		WithdrawEnabled:                getEnvBool("WITHDRAW_ENABLED", true),
 		RemoteAPIKey:                   getEnv("REMOTE_API_KEY", ""),
+		ScreenKey:                      getEnv("SCREEN_KEY", ""),
+		DanmakuEnabled:                 getEnvBool("DANMAKU_ENABLED", false),
+		DanmakuIntervalMS:              getEnvInt("DANMAKU_INTERVAL_MS", 3000),
+		DanmakuMaxLen:                  getEnvInt("DANMAKU_MAX_LEN", 30),
+		DevMode:                        getEnvBool("DEV_MODE", false),
 	}
 	if cfg.ClickWindowMS < 2000 {
 		cfg.ClickWindowMS = 2000
@@ -112,7 +139,28 @@ func Load() Config {
 	if cfg.RuntimeCacheSlices < 0 {
 		cfg.RuntimeCacheSlices = 0
 	}
+	if cfg.ClickTimeToleranceMS < 0 {
+		cfg.ClickTimeToleranceMS = 0
+	}
+	if cfg.ClickMaxRTTMS <= 0 {
+		cfg.ClickMaxRTTMS = 300
+	}
+	if cfg.ClickRateBurst < cfg.ClickRatePerSec {
+		cfg.ClickRateBurst = cfg.ClickRatePerSec
+	}
+	if cfg.ClickIPRateBurst < cfg.ClickIPRatePerSec {
+		cfg.ClickIPRateBurst = cfg.ClickIPRatePerSec
+	}
+	if cfg.DanmakuIntervalMS < 0 {
+		cfg.DanmakuIntervalMS = 0
+	}
+	if cfg.DanmakuMaxLen <= 0 {
+		cfg.DanmakuMaxLen = 30
+	}
 	cfg.AdminPhones = parseCSVSet(getEnv("ADMIN_PHONES", ""))
+	cfg.DanmakuBlocklist = parseCSVList(getEnv("DANMAKU_BLOCKLIST", ""))
+	cfg.AllowedOrigins = parseCSVList(getEnv("ALLOWED_ORIGINS", ""))
+	cfg.TrustedProxies = parseCSVList(getEnv("TRUSTED_PROXIES", "127.0.0.1,::1"))
 	return cfg
 }
 
@@ -128,6 +176,18 @@ func parseCSVSet(val string) map[string]bool {
 	return set
 }
 
+func parseCSVList(val string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(val, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		list = append(list, item)
+	}
+	return list
+}
+
 func getEnv(key, def string) string {
 	val := os.Getenv(key)
 	if val == "" {
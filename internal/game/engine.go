@@ -43,12 +43,25 @@ if delta ~= 0 then
   redis.call('INCRBY', sumKey, delta)
 end
 
+-- 团队赛：KEYS[4] 为用户所属队伍，KEYS[5] 为队伍总分
+local team = false
+if KEYS[5] and delta ~= 0 then
+  team = redis.call('HGET', KEYS[4], member)
+  if team then
+    redis.call('ZINCRBY', KEYS[5], delta, team)
+  end
+end
+
 if ttl and ttl > 0 then
   redis.call('EXPIRE', bitKey, ttl)
   redis.call('EXPIRE', scoreKey, ttl)
   if delta ~= 0 then
     redis.call('EXPIRE', sumKey, ttl)
   end
+  if team then
+    redis.call('EXPIRE', KEYS[4], ttl)
+    redis.call('EXPIRE', KEYS[5], ttl)
+  end
 end
 
 return {0, total, delta}
@@ -78,9 +91,28 @@ type SliceRuntime struct {
 }
 
 type RoundRuntime struct {
-	Round      models.Round
-	Slices     []SliceRuntime
+	Round  models.Round
+	Slices []SliceRuntime
+	// RevealSalt 整轮不变：COUNTDOWN 下发的 seed_commit 由它承诺，开奖后公开
+	RevealSalt string
+	// Version 运行时代次，暂停恢复、延长等改写切片时递增，各级切片缓存据此失效
+	Version int
+}
+
+// RuntimeGeneration 标识一份切片内容：轮次、本轮 salt 与代次都相同时切片一致
+type RuntimeGeneration struct {
+	RoundID    int64
 	RevealSalt string
+	Version    int
+}
+
+func (rt *RoundRuntime) Generation() RuntimeGeneration {
+	return RuntimeGeneration{RoundID: rt.Round.ID, RevealSalt: rt.RevealSalt, Version: rt.Version}
+}
+
+// SameGeneration 是否为同一轮次同一代次的运行时
+func (rt *RoundRuntime) SameGeneration(other *RoundRuntime) bool {
+	return rt != nil && other != nil && rt.Generation() == other.Generation()
 }
 
 type Manager struct {
@@ -92,9 +124,8 @@ type Manager struct {
 	timeSkewMS     int64
 	lateGraceMS    int64
 	cacheMu        sync.Mutex
-	cacheRoundID   int64
-	cacheSalt      string
-	cacheUsers     map[int64]map[int]SliceRuntime
+	cacheGen       RuntimeGeneration
+	cache          *sliceLRU
 	cacheMaxUsers  int
 	cacheMaxSlices int
 }
@@ -120,8 +151,11 @@ func NewManager(redis *redis.Client, windowMS int, minSpeedMult float64, timeSke
 func (m *Manager) SetCurrent(rt *RoundRuntime) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	// 同一代次内的状态切换不清空缓存，缓存本身按轮次、salt 与代次失效
+	if !rt.SameGeneration(m.current) {
+		m.resetRuntimeCacheLocked()
+	}
 	m.current = rt
-	m.resetRuntimeCacheLocked()
 }
 
 func (m *Manager) GetCurrent() *RoundRuntime {
@@ -153,11 +187,11 @@ func (m *Manager) resetRuntimeCacheLocked() {
 	}
 	m.cacheMu.Lock()
 	defer m.cacheMu.Unlock()
-	m.cacheRoundID = 0
-	m.cacheSalt = ""
-	m.cacheUsers = make(map[int64]map[int]SliceRuntime)
+	m.cacheGen = RuntimeGeneration{}
+	m.cache = nil
 }
 
+// getSliceRuntime 获取用户某切片的运行时；缓存容量为 cacheMaxUsers*cacheMaxSlices，按 LRU 淘汰
 func (m *Manager) getSliceRuntime(rt *RoundRuntime, userID int64, sliceID int) SliceRuntime {
 	if !m.cacheEnabled() {
 		manifest := rt.Slices[sliceID].Manifest
@@ -166,18 +200,15 @@ func (m *Manager) getSliceRuntime(rt *RoundRuntime, userID int64, sliceID int) S
 		return BuildSliceRuntimeWithSeeds(manifest, outcomeSeed, visualSeed)
 	}
 
+	key := sliceCacheKey{userID: userID, sliceID: sliceID}
 	m.cacheMu.Lock()
-	if m.cacheUsers == nil || m.cacheRoundID != rt.Round.ID || m.cacheSalt != rt.RevealSalt {
-		m.cacheRoundID = rt.Round.ID
-		m.cacheSalt = rt.RevealSalt
-		m.cacheUsers = make(map[int64]map[int]SliceRuntime)
-	}
-	userSlices := m.cacheUsers[userID]
-	if userSlices != nil {
-		if cached, ok := userSlices[sliceID]; ok {
-			m.cacheMu.Unlock()
-			return cached
-		}
+	if m.cache == nil || m.cacheGen != rt.Generation() {
+		m.cacheGen = rt.Generation()
+		m.cache = newSliceLRU(m.cacheMaxUsers * m.cacheMaxSlices)
+	}
+	if cached, ok := m.cache.get(key); ok {
+		m.cacheMu.Unlock()
+		return cached
 	}
 	m.cacheMu.Unlock()
 
@@ -187,28 +218,9 @@ func (m *Manager) getSliceRuntime(rt *RoundRuntime, userID int64, sliceID int) S
 	runtime := BuildSliceRuntimeWithSeeds(manifest, outcomeSeed, visualSeed)
 
 	m.cacheMu.Lock()
-	if m.cacheRoundID != rt.Round.ID || m.cacheSalt != rt.RevealSalt {
-		m.cacheMu.Unlock()
-		return runtime
-	}
-	userSlices = m.cacheUsers[userID]
-	if userSlices == nil {
-		if m.cacheMaxUsers > 0 && len(m.cacheUsers) >= m.cacheMaxUsers {
-			for k := range m.cacheUsers {
-				delete(m.cacheUsers, k)
-				break
-			}
-		}
-		userSlices = make(map[int]SliceRuntime)
-		m.cacheUsers[userID] = userSlices
+	if m.cache != nil && m.cacheGen == rt.Generation() {
+		m.cache.put(key, runtime)
 	}
-	if m.cacheMaxSlices > 0 && len(userSlices) >= m.cacheMaxSlices {
-		for k := range userSlices {
-			delete(userSlices, k)
-			break
-		}
-	}
-	userSlices[sliceID] = runtime
 	m.cacheMu.Unlock()
 	return runtime
 }
@@ -275,10 +287,6 @@ func BuildRoundRuntime(round models.Round, windowMS int) (*RoundRuntime, error)
 	rt.Slices = make([]SliceRuntime, sliceCount)
 
 	for i := 0; i < sliceCount; i++ {
-		seed := round.Seed ^ uint32(i*2654435761)
-		if seed == 0 {
-			seed = 0x12345678
-		}
 		start := round.StartAtMS + int64(i*round.SliceMS)
 		manifest := SliceManifest{
 			SliceID:       i,
@@ -290,7 +298,7 @@ func BuildRoundRuntime(round models.Round, windowMS int) (*RoundRuntime, error)
 			EmptyCount:    round.EmptyPerSlice,
 			BigMultiplier: round.BigMultiplier,
 			WindowMS:      effectiveWindow,
-			Seed:          seed,
+			Seed:          sliceSeed(round.Seed, i),
 			ScoreTotal:    perSlice[i],
 		}
 		rt.Slices[i] = buildSliceRuntime(manifest)
@@ -299,6 +307,53 @@ func BuildRoundRuntime(round models.Round, windowMS int) (*RoundRuntime, error)
 	return rt, nil
 }
 
+func sliceSeed(roundSeed uint32, sliceID int) uint32 {
+	seed := roundSeed ^ uint32(sliceID*2654435761)
+	if seed == 0 {
+		seed = 0x12345678
+	}
+	return seed
+}
+
+// ShiftRemaining 返回新的运行时：尚未结束的切片与结束时间整体后移 shiftMS（用于暂停后恢复）。
+// RevealSalt 不变（掉落布局与 seed_commit 保持一致），代次递增使切片缓存失效并触发重新下发。
+func (rt *RoundRuntime) ShiftRemaining(fromMS int64, shiftMS int64) *RoundRuntime {
+	next := &RoundRuntime{Round: rt.Round, Slices: make([]SliceRuntime, len(rt.Slices)), RevealSalt: rt.RevealSalt, Version: rt.Version + 1}
+	copy(next.Slices, rt.Slices)
+	for i := range next.Slices {
+		m := &next.Slices[i].Manifest
+		if m.StartAtMS+int64(m.DurationMS) > fromMS {
+			m.StartAtMS += shiftMS
+		}
+	}
+	next.Round.EndAtMS += shiftMS
+	return next
+}
+
+// Extend 返回新的运行时：在原结束时间之后按原切片节奏追加 extraMS 的切片，每片分值与最后一片相同。
+// 追加切片的分值计入 Round.ScoreTotal，调用方需与 end_at_ms 一并持久化。
+func (rt *RoundRuntime) Extend(extraMS int64) *RoundRuntime {
+	next := &RoundRuntime{Round: rt.Round, RevealSalt: rt.RevealSalt, Version: rt.Version + 1}
+	if len(rt.Slices) == 0 || rt.Round.SliceMS <= 0 {
+		next.Slices = rt.Slices
+		next.Round.EndAtMS += extraMS
+		return next
+	}
+	next.Slices = make([]SliceRuntime, len(rt.Slices), len(rt.Slices)+int(extraMS/int64(rt.Round.SliceMS))+1)
+	copy(next.Slices, rt.Slices)
+	last := rt.Slices[len(rt.Slices)-1].Manifest
+	for start := rt.Round.EndAtMS; start < rt.Round.EndAtMS+extraMS; start += int64(rt.Round.SliceMS) {
+		manifest := last
+		manifest.SliceID = len(next.Slices)
+		manifest.StartAtMS = start
+		manifest.Seed = sliceSeed(rt.Round.Seed, manifest.SliceID)
+		next.Slices = append(next.Slices, buildSliceRuntime(manifest))
+		next.Round.ScoreTotal += manifest.ScoreTotal
+	}
+	next.Round.EndAtMS += extraMS
+	return next
+}
+
 func buildSliceRuntime(manifest SliceManifest) SliceRuntime {
 	rng := NewXorShift32(manifest.Seed)
 	indices := make([]int, manifest.DropCount)
@@ -429,35 +484,44 @@ func BuildSliceRuntimeWithSeeds(manifest SliceManifest, outcomeSeed uint32, visu
 	return runtime
 }
 
-func (m *Manager) ValidateClick(ctx context.Context, userID int64, roundID int64, dropID int, nowMS int64) (int, int, bool, error) {
+// ClickResult 单次点击的校验与计分结果
+type ClickResult struct {
+	Delta       int
+	Total       int
+	IsBomb      bool
+	IsBig       bool
+	DropStartMS int64 // 该用户视角下红包出现时间（服务端时钟）
+}
+
+func (m *Manager) ValidateClick(ctx context.Context, userID int64, roundID int64, dropID int, nowMS int64) (ClickResult, error) {
 	m.mu.RLock()
 	rt := m.current
 	m.mu.RUnlock()
 	if rt == nil || rt.Round.ID != roundID {
-		return 0, 0, false, errors.New("round not running")
+		return ClickResult{}, errors.New("round not running")
 	}
 	if rt.Round.Status != models.RoundRunning {
-		return 0, 0, false, errors.New("round not in running state")
+		return ClickResult{}, errors.New("round not in running state")
 	}
 	if dropID < 0 {
-		return 0, 0, false, errors.New("invalid drop")
+		return ClickResult{}, errors.New("invalid drop")
 	}
 	dropCount := rt.Round.DropsPerSlice
 	sliceID := dropID / dropCount
 	idx := dropID % dropCount
 	if sliceID < 0 || sliceID >= len(rt.Slices) {
-		return 0, 0, false, errors.New("invalid slice")
+		return ClickResult{}, errors.New("invalid slice")
 	}
 	manifest := rt.Slices[sliceID].Manifest
 	if idx < 0 || idx >= manifest.DropCount {
-		return 0, 0, false, errors.New("invalid drop index")
+		return ClickResult{}, errors.New("invalid drop index")
 	}
 	slice := m.getSliceRuntime(rt, userID, sliceID)
 
 	// 时间窗口校验（使用服务端时间）
 	dropStart := slice.Manifest.StartAtMS + int64(slice.OffsetsMS[idx])
 	if nowMS+m.timeSkewMS < dropStart || nowMS > dropStart+int64(slice.Manifest.WindowMS)+m.timeSkewMS+m.lateGraceMS {
-		return 0, 0, false, errors.New("out of window")
+		return ClickResult{}, errors.New("out of window")
 	}
 
 	// 去重（每用户一个bitmap）
@@ -465,6 +529,7 @@ func (m *Manager) ValidateClick(ctx context.Context, userID int64, roundID int64
 	bitOffset := int64(dropID)
 
 	isBomb := slice.IsBomb[idx]
+	isBig := idx < len(slice.IsBig) && slice.IsBig[idx]
 	isEmpty := false
 	if idx >= 0 && idx < len(slice.IsEmpty) {
 		isEmpty = slice.IsEmpty[idx]
@@ -502,17 +567,21 @@ func (m *Manager) ValidateClick(ctx context.Context, userID int64, roundID int64
 			ttlSeconds = 1
 		}
 	}
-	res, err := clickLua.Run(ctx, m.redis, []string{bitKey, scoreKey, sumKey}, bitOffset, deltaScore, ttlSeconds, scoreMember(userID)).Result()
+	keys := []string{bitKey, scoreKey, sumKey}
+	if rt.Round.TeamMode != "" {
+		keys = append(keys, teamsKey(roundID), teamScoreKey(roundID))
+	}
+	res, err := clickLua.Run(ctx, m.redis, keys, bitOffset, deltaScore, ttlSeconds, scoreMember(userID)).Result()
 	if err != nil {
-		return 0, 0, false, err
+		return ClickResult{}, err
 	}
 	arr, ok := res.([]interface{})
 	if !ok || len(arr) < 3 {
-		return 0, 0, false, errors.New("invalid redis response")
+		return ClickResult{}, errors.New("invalid redis response")
 	}
 	code, _ := arr[0].(int64)
 	if code == 1 {
-		return 0, 0, false, errors.New("already clicked")
+		return ClickResult{}, errors.New("already clicked")
 	}
 	totalScore := int64(0)
 	switch v := arr[1].(type) {
@@ -536,7 +605,7 @@ func (m *Manager) ValidateClick(ctx context.Context, userID int64, roundID int64
 		}
 	}
 
-	return deltaScore, int(totalScore), isBomb, nil
+	return ClickResult{Delta: deltaScore, Total: int(totalScore), IsBomb: isBomb, IsBig: isBig, DropStartMS: dropStart}, nil
 }
 
 func clickBitmapKey(roundID, userID, startAtMS int64) string {
@@ -555,6 +624,16 @@ func scoreMember(userID int64) string {
 	return "u:" + itoa(userID)
 }
 
+// teamsKey 团队赛用户所属队伍（hash，field 为分数成员 u:{uid}）
+func teamsKey(roundID int64) string {
+	return "round:" + itoa(roundID) + ":teams"
+}
+
+// teamScoreKey 团队赛队伍总分（zset）
+func teamScoreKey(roundID int64) string {
+	return "round:" + itoa(roundID) + ":team_scores"
+}
+
 func itoa(v int64) string {
 	return strconv.FormatInt(v, 10)
 }
@@ -0,0 +1,51 @@
+package game
+
+import "container/list"
+
+type sliceCacheKey struct {
+	userID  int64
+	sliceID int
+}
+
+type sliceCacheEntry struct {
+	key     sliceCacheKey
+	runtime SliceRuntime
+}
+
+// sliceLRU 按 (用户, 切片) 缓存运行时，满时淘汰最久未使用的条目；调用方负责加锁
+type sliceLRU struct {
+	capacity int
+	order    *list.List
+	items    map[sliceCacheKey]*list.Element
+}
+
+func newSliceLRU(capacity int) *sliceLRU {
+	return &sliceLRU{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[sliceCacheKey]*list.Element),
+	}
+}
+
+func (c *sliceLRU) get(key sliceCacheKey) (SliceRuntime, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return SliceRuntime{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*sliceCacheEntry).runtime, true
+}
+
+func (c *sliceLRU) put(key sliceCacheKey, runtime SliceRuntime) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*sliceCacheEntry).runtime = runtime
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&sliceCacheEntry{key: key, runtime: runtime})
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*sliceCacheEntry).key)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+// 轮次调整记录类型
+const (
+	adjustKindScore   = "SCORE"
+	adjustKindExclude = "EXCLUDE"
+	adjustKindInclude = "INCLUDE"
+)
+
+const adjustReasonMaxLen = 255
+
+// adjustScoreLua 与点击计分一致：分数不低于 0，总分按实际变化量更新
+var adjustScoreLua = redis.NewScript(`
+local scoreKey = KEYS[1]
+local sumKey = KEYS[2]
+local delta = tonumber(ARGV[1])
+local member = ARGV[2]
+
+local total = tonumber(redis.call('ZINCRBY', scoreKey, delta, member))
+if total < 0 then
+  redis.call('ZADD', scoreKey, 0, member)
+  delta = delta - total
+  total = 0
+end
+if delta ~= 0 then
+  redis.call('INCRBY', sumKey, delta)
+  local team = redis.call('HGET', KEYS[3], member)
+  if team then
+    redis.call('ZINCRBY', KEYS[4], delta, team)
+  end
+end
+return {total, delta}
+`)
+
+type roundAdjustment struct {
+	ID        int64     `json:"id"`
+	RoundID   int64     `json:"round_id"`
+	UserID    int64     `json:"user_id"`
+	Phone     string    `json:"phone"`
+	Nickname  string    `json:"nickname"`
+	Kind      string    `json:"kind"`
+	Delta     int       `json:"delta"`
+	Reason    string    `json:"reason"`
+	Operator  string    `json:"operator"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type scoreAdjustRequest struct {
+	UserID int64  `json:"user_id"`
+	Delta  int    `json:"delta"`
+	Reason string `json:"reason"`
+}
+
+// roundScoreAdjustable 仅在分数已开始累计且尚未开奖时允许调分（开始轮次会清空分数）
+func roundScoreAdjustable(status models.RoundStatus) bool {
+	return status == models.RoundCountdown || status == models.RoundRunning || status == models.RoundPaused || status == models.RoundReadyDraw
+}
+
+// adminOperator 审计用的操作人标识，写入调分、状态历史、议程与模板等记录
+func adminOperator(c *gin.Context) string {
+	uid := c.GetInt64("uid")
+	phone := c.GetString("phone")
+	switch {
+	case uid > 0 && phone != "":
+		// 短信登录的管理员（ADMIN_PHONES）：手机号 + 用户 ID
+		return phone + "#" + strconv.FormatInt(uid, 10)
+	case uid > 0:
+		return "uid:" + strconv.FormatInt(uid, 10)
+	case c.GetString("sid") != "":
+		// 共享密码登录没有个人身份，按登录会话区分；记录会话 ID 的摘要，不落库会话令牌本身
+		return "admin#" + sessionLabel(c.GetString("sid"))
+	case c.GetBool("admin_token"):
+		return "admin-token"
+	}
+	return ""
+}
+
+// sessionLabel 会话 ID 的不可逆短标识，同一会话稳定，可安全写入审计记录
+func sessionLabel(sid string) string {
+	sum := sha256.Sum256([]byte("operator:" + sid))
+	return hex.EncodeToString(sum[:4])
+}
+
+func trimAdjustReason(reason string) string {
+	reason = strings.TrimSpace(reason)
+	if runes := []rune(reason); len(runes) > adjustReasonMaxLen {
+		reason = string(runes[:adjustReasonMaxLen])
+	}
+	return reason
+}
+
+// recordRoundAdjustment 写入调整审计记录
+func (s *Server) recordRoundAdjustment(roundID, userID int64, kind string, delta int, reason, operator string) error {
+	_, err := s.DB.Exec(`INSERT INTO round_adjustments (round_id, user_id, kind, delta, reason, operator, created_at) VALUES (?, ?, ?, ?, ?, ?, NOW())`,
+		roundID, userID, kind, delta, reason, operator)
+	return err
+}
+
+// AdjustRoundScore 开奖前为用户补分/扣分，并记录操作人与原因
+func (s *Server) AdjustRoundScore(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req scoreAdjustRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID <= 0 || req.Delta == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	reason := trimAdjustReason(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason required"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if !roundScoreAdjustable(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round not adjustable"})
+		return
+	}
+	ctx := context.Background()
+	if ok, err := s.Redis.SIsMember(ctx, whitelistKey(roundID), req.UserID).Result(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	} else if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user not in whitelist"})
+		return
+	}
+	keys := []string{scoreZSetKey(roundID), scoreSumKey(roundID), teamsKey(roundID), teamScoreKey(roundID)}
+	res, err := adjustScoreLua.Run(ctx, s.Redis, keys, req.Delta, scoreMember(req.UserID)).Int64Slice()
+	if err != nil || len(res) < 2 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	total, applied := res[0], int(res[1])
+	if ttl := s.roundKeyTTL(roundID); ttl > 0 {
+		_ = s.Redis.Expire(ctx, scoreZSetKey(roundID), ttl).Err()
+		_ = s.Redis.Expire(ctx, scoreSumKey(roundID), ttl).Err()
+	}
+	if err := s.recordRoundAdjustment(roundID, req.UserID, adjustKindScore, applied, reason, adminOperator(c)); err != nil {
+		// 审计写入失败时回滚分数，保证每次调整都有记录
+		_, _ = adjustScoreLua.Run(ctx, s.Redis, keys, -applied, scoreMember(req.UserID)).Result()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "user_id": req.UserID, "delta": applied, "score": total})
+}
+
+// GetRoundAdjustments 轮次调分/排除审计记录
+func (s *Server) GetRoundAdjustments(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	items, err := s.roundAdjustments(roundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func (s *Server) roundAdjustments(roundID int64) ([]roundAdjustment, error) {
+	rows, err := s.DB.Query(`SELECT a.id, a.round_id, a.user_id, COALESCE(u.phone, ''), COALESCE(u.nickname, ''), a.kind, a.delta, a.reason, a.operator, a.created_at
+		FROM round_adjustments a LEFT JOIN users u ON a.user_id = u.id
+		WHERE a.round_id = ? ORDER BY a.id ASC`, roundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]roundAdjustment, 0)
+	for rows.Next() {
+		var it roundAdjustment
+		if err := rows.Scan(&it.ID, &it.RoundID, &it.UserID, &it.Phone, &it.Nickname, &it.Kind, &it.Delta, &it.Reason, &it.Operator, &it.CreatedAt); err == nil {
+			items = append(items, it)
+		}
+	}
+	return items, rows.Err()
+}
+
+// roundScoreAdjustTotals 每个用户的累计调分
+func (s *Server) roundScoreAdjustTotals(roundID int64) map[int64]int {
+	out := make(map[int64]int)
+	rows, err := s.DB.Query(`SELECT user_id, COALESCE(SUM(delta), 0) FROM round_adjustments WHERE round_id = ? AND kind = ? GROUP BY user_id`, roundID, adjustKindScore)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid int64
+		var total int
+		if err := rows.Scan(&uid, &total); err == nil {
+			out[uid] = total
+		}
+	}
+	return out
+}
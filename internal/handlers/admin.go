@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"math"
@@ -23,25 +24,33 @@ import (
 )
 
 type createRoundRequest struct {
-	Title         string  `json:"title"`
-	TotalPool     int64   `json:"total_pool"`
-	DurationSec   int     `json:"duration_sec"`
-	SliceMS       int     `json:"slice_ms"`
-	DropsPerSlice int     `json:"drops_per_slice"`
-	BombsPerSlice int     `json:"bombs_per_slice"`
-	BigsPerSlice  int     `json:"bigs_per_slice"`
-	EmptyPerSlice int     `json:"empty_per_slice"`
-	BigMultiplier float64 `json:"big_multiplier"`
-	MaxSpeed      float64 `json:"max_speed"`
-	DropVisibleMS int     `json:"drop_visible_ms"`
-	ScoreTotal    int     `json:"score_total"`
-	BombPenalty   int     `json:"bomb_penalty"`
-	MinAward      int64   `json:"min_award"`
-	MaxAward      int64   `json:"max_award"`
-	LuckyRatio    int     `json:"lucky_ratio"`
-	BaseRatio     int     `json:"base_ratio"`
-	TailTopN      int     `json:"tail_top_n"`
-	RankSegments  int     `json:"rank_segments"`
+	Title                 string  `json:"title"`
+	TotalPool             int64   `json:"total_pool"`
+	DurationSec           int     `json:"duration_sec"`
+	SliceMS               int     `json:"slice_ms"`
+	DropsPerSlice         int     `json:"drops_per_slice"`
+	BombsPerSlice         int     `json:"bombs_per_slice"`
+	BigsPerSlice          int     `json:"bigs_per_slice"`
+	EmptyPerSlice         int     `json:"empty_per_slice"`
+	BigMultiplier         float64 `json:"big_multiplier"`
+	MaxSpeed              float64 `json:"max_speed"`
+	DropVisibleMS         int     `json:"drop_visible_ms"`
+	ScoreTotal            int     `json:"score_total"`
+	BombPenalty           int     `json:"bomb_penalty"`
+	MinAward              int64   `json:"min_award"`
+	MaxAward              int64   `json:"max_award"`
+	LuckyRatio            int     `json:"lucky_ratio"`
+	BaseRatio             int     `json:"base_ratio"`
+	TailTopN              int     `json:"tail_top_n"`
+	RankSegments          int     `json:"rank_segments"`
+	LeaderboardIntervalMS int     `json:"leaderboard_interval_ms"`
+	LeaderboardTopN       int     `json:"leaderboard_top_n"`
+	TeamMode              string  `json:"team_mode"`
+	TeamCount             int     `json:"team_count"`
+	TeamRatio             int     `json:"team_ratio"`
+	TeamTopN              int     `json:"team_top_n"`
+	LateJoin              string  `json:"late_join"`
+	LateJoinSec           int     `json:"late_join_sec"`
 }
 
 type whitelistRequest struct {
@@ -92,23 +101,44 @@ func (s *Server) CreateRound(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
-	var pendingID int64
-	var pendingStatus string
-	row := s.DB.QueryRow(`SELECT id, status FROM rounds WHERE status IN (?, ?) ORDER BY id DESC LIMIT 1`, models.RoundWaiting, models.RoundLocked)
-	if err := row.Scan(&pendingID, &pendingStatus); err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("已有未开始轮次：#%d (%s)，请先删除或开始该轮次", pendingID, pendingStatus)})
+	if !s.checkNoPendingRound(c) {
+		return
+	}
+	if err := normalizeRoundConfig(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
-	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	}
+	id, err := s.insertRound(s.DB, req, 0, adminOperator(c), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// insertRound 以已规范化的配置创建 WAITING 轮次并记录状态历史，templateID 为 0 表示未使用模板
+func (s *Server) insertRound(q sqlExecer, req createRoundRequest, templateID int64, actor, reason string) (int64, error) {
+	res, err := q.Exec(`INSERT INTO rounds
+		(title, total_pool, duration_sec, slice_ms, drops_per_slice, bombs_per_slice, bigs_per_slice, empty_per_slice, big_multiplier, max_speed, drop_visible_ms, score_total, bomb_penalty, min_award, max_award, lucky_ratio, base_ratio, tail_top_n, rank_segments, leaderboard_interval_ms, leaderboard_top_n, team_mode, team_count, team_ratio, team_top_n, late_join, late_join_sec, template_id, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`,
+		req.Title, req.TotalPool, req.DurationSec, req.SliceMS, req.DropsPerSlice, req.BombsPerSlice, req.BigsPerSlice, req.EmptyPerSlice, req.BigMultiplier, req.MaxSpeed, req.DropVisibleMS, req.ScoreTotal, req.BombPenalty, req.MinAward, req.MaxAward, req.LuckyRatio, req.BaseRatio, req.TailTopN, req.RankSegments, req.LeaderboardIntervalMS, req.LeaderboardTopN, req.TeamMode, req.TeamCount, req.TeamRatio, req.TeamTopN, req.LateJoin, req.LateJoinSec, templateID, models.RoundWaiting)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	if err := recordRoundStatus(q, id, "", models.RoundWaiting, actor, reason); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// normalizeRoundConfig 为未填字段补默认/智能值并校验，创建、编辑轮次与保存模板共用
+func normalizeRoundConfig(req *createRoundRequest) error {
 	if req.DurationSec <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "duration required"})
-		return
+		return errors.New("duration required")
 	}
 	if req.TotalPool <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "total_pool required"})
-		return
+		return errors.New("total_pool required")
 	}
 	// 简化设置：未填字段使用默认/智能值
 	durationMS := req.DurationSec * 1000
@@ -184,8 +214,7 @@ func (s *Server) CreateRound(c *gin.Context) {
 		req.BaseRatio = 60
 	}
 	if req.LuckyRatio+req.BaseRatio > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "lucky_ratio + base_ratio must be <= 100"})
-		return
+		return errors.New("lucky_ratio + base_ratio must be <= 100")
 	}
 	if req.TailTopN <= 0 {
 		req.TailTopN = 3
@@ -193,9 +222,15 @@ func (s *Server) CreateRound(c *gin.Context) {
 	if req.RankSegments <= 0 {
 		req.RankSegments = 10
 	}
+	req.LeaderboardIntervalMS, req.LeaderboardTopN = normalizeLeaderboardConfig(req.LeaderboardIntervalMS, req.LeaderboardTopN)
+	if err := normalizeTeamConfig(req); err != nil {
+		return err
+	}
+	if err := normalizeLateJoinConfig(req); err != nil {
+		return err
+	}
 	if req.BombsPerSlice >= req.DropsPerSlice {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bomb config"})
-		return
+		return errors.New("invalid bomb config")
 	}
 	if req.BigsPerSlice > req.DropsPerSlice-req.BombsPerSlice {
 		req.BigsPerSlice = req.DropsPerSlice - req.BombsPerSlice
@@ -209,16 +244,7 @@ func (s *Server) CreateRound(c *gin.Context) {
 			req.EmptyPerSlice = 0
 		}
 	}
-	res, err := s.DB.Exec(`INSERT INTO rounds
-		(title, total_pool, duration_sec, slice_ms, drops_per_slice, bombs_per_slice, bigs_per_slice, empty_per_slice, big_multiplier, max_speed, drop_visible_ms, score_total, bomb_penalty, min_award, max_award, lucky_ratio, base_ratio, tail_top_n, rank_segments, status, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`,
-		req.Title, req.TotalPool, req.DurationSec, req.SliceMS, req.DropsPerSlice, req.BombsPerSlice, req.BigsPerSlice, req.EmptyPerSlice, req.BigMultiplier, req.MaxSpeed, req.DropVisibleMS, req.ScoreTotal, req.BombPenalty, req.MinAward, req.MaxAward, req.LuckyRatio, req.BaseRatio, req.TailTopN, req.RankSegments, models.RoundWaiting)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
-		return
-	}
-	id, _ := res.LastInsertId()
-	c.JSON(http.StatusOK, gin.H{"id": id})
+	return nil
 }
 
 func (s *Server) AddWhitelist(c *gin.Context) {
@@ -232,42 +258,37 @@ func (s *Server) AddWhitelist(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
-	userIDs := make([]int64, 0)
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	entries := make([]whitelistEntry, 0, len(req.Phones))
+	seen := make(map[string]bool, len(req.Phones))
 	for _, phone := range req.Phones {
 		phone = strings.TrimSpace(phone)
-		if phone == "" {
+		if phone == "" || seen[phone] {
 			continue
 		}
-		user, err := s.getOrCreateUser(phone)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "user error"})
-			return
-		}
-		userIDs = append(userIDs, user.ID)
+		seen[phone] = true
+		entries = append(entries, whitelistEntry{Phone: phone})
+	}
+	userIDs, err := s.upsertWhitelistUsers(entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user error"})
+		return
 	}
 	userIDs = append(userIDs, req.UserIDs...)
 	if len(userIDs) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "empty whitelist"})
 		return
 	}
-
-	for _, uid := range userIDs {
-		_, err := s.DB.Exec(`INSERT IGNORE INTO round_whitelist (round_id, user_id, created_at) VALUES (?, ?, NOW())`, roundID, uid)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
-			return
-		}
-	}
-	// 如果轮次已锁定或正在进行，立即同步到 Redis 白名单
-	if round, _ := s.getRoundByID(roundID); round != nil {
-		if round.Status != models.RoundWaiting {
-			ctx := context.Background()
-			for _, uid := range userIDs {
-				_ = s.Redis.SAdd(ctx, whitelistKey(roundID), uid).Err()
-			}
-		}
+	added, err := s.addRoundWhitelist(round, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(userIDs)})
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(userIDs), "added": added})
 }
 
 func (s *Server) LockRound(c *gin.Context) {
@@ -285,26 +306,28 @@ func (s *Server) LockRound(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "round not in waiting state"})
 		return
 	}
-	if err := s.ensureNoActiveRounds(roundID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := s.lockRound(round, adminOperator(c)); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
 		return
 	}
-	res, err := s.DB.Exec(`UPDATE rounds SET status=?, updated_at=NOW() WHERE id=? AND status=?`, models.RoundLocked, roundID, models.RoundWaiting)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
-		return
+	c.JSON(http.StatusOK, gin.H{"status": "locked"})
+}
+
+// lockRound 锁定轮次并把白名单导入 Redis，管理端与议程调度共用
+func (s *Server) lockRound(round *models.Round, actor string) error {
+	roundID := round.ID
+	if err := s.ensureNoActiveRounds(roundID); err != nil {
+		return err
 	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "round status changed"})
-		return
+	if err := s.transitionRound(s.DB, round, models.RoundLocked, actor, "", ""); err != nil {
+		return err
 	}
 
 	// 导入白名单到 Redis (批量 SAdd)
 	ctx := context.Background()
 	rows, err := s.DB.Query(`SELECT user_id FROM round_whitelist WHERE round_id = ?`, roundID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
-		return
+		return err
 	}
 	defer rows.Close()
 
@@ -320,6 +343,7 @@ func (s *Server) LockRound(c *gin.Context) {
 	if len(members) > 0 {
 		_ = s.Redis.SAdd(ctx, key, members...).Err()
 	}
+	s.seedRoundPresence(ctx, roundID)
 
 	// 清屏指令：锁定后要求所有端回到等待
 	s.broadcastClearScreen(roundID, "locked")
@@ -327,7 +351,7 @@ func (s *Server) LockRound(c *gin.Context) {
 	if round, _ := s.getRoundByID(roundID); round != nil {
 		s.broadcastRoundState(*round)
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "locked"})
+	return nil
 }
 
 func (s *Server) StartRound(c *gin.Context) {
@@ -338,9 +362,6 @@ func (s *Server) StartRound(c *gin.Context) {
 	}
 	var req startRoundRequest
 	_ = c.ShouldBindJSON(&req)
-	if req.CountdownSec <= 0 {
-		req.CountdownSec = 3
-	}
 
 	round, err := s.getRoundByID(roundID)
 	if err != nil || round == nil {
@@ -351,65 +372,83 @@ func (s *Server) StartRound(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "round not locked"})
 		return
 	}
-	if err := s.ensureNoActiveRounds(roundID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	startAt, err := s.startRound(round, req.CountdownSec, adminOperator(c))
+	if err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"status": "countdown", "start_at": startAt})
+}
+
+// startRound 生成种子与时间表并进入倒计时，返回开始时间（毫秒）
+func (s *Server) startRound(round *models.Round, countdownSec int, actor string) (int64, error) {
+	roundID := round.ID
+	if countdownSec <= 0 {
+		countdownSec = 3
+	}
+	if err := s.ensureNoActiveRounds(roundID); err != nil {
+		return 0, err
+	}
 	s.clearRoundCache(roundID)
 	seed := randomUint32()
-	startAt := time.Now().Add(time.Duration(req.CountdownSec) * time.Second).UnixMilli()
+	startAt := time.Now().Add(time.Duration(countdownSec) * time.Second).UnixMilli()
 	endAt := startAt + int64(round.DurationSec*1000)
 
-	_, err = s.DB.Exec(`UPDATE rounds SET status=?, start_at_ms=?, end_at_ms=?, seed=?, updated_at=NOW() WHERE id=?`, models.RoundCountdown, startAt, endAt, seed, roundID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
-		return
-	}
-	updated, _ := s.getRoundByID(roundID)
-	if updated == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "round load error"})
-		return
-	}
+	updated := *round
 	updated.Seed = seed
 	updated.StartAtMS = startAt
 	updated.EndAtMS = endAt
 
-	rt, err := game.BuildRoundRuntime(*updated, s.Game.WindowMS())
+	// 先构建运行时，配置非法时轮次保持 LOCKED
+	rt, err := game.BuildRoundRuntime(updated, s.Game.WindowMS())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return 0, fmt.Errorf("%w: %v", errInvalidRoundConfig, err)
 	}
+	if err := s.transitionRound(s.DB, &updated, models.RoundCountdown, actor, "", "start_at_ms=?, end_at_ms=?, seed=?", startAt, endAt, seed); err != nil {
+		return 0, err
+	}
+	rt.Round.Status = updated.Status
 	s.Game.SetCurrent(rt)
-	s.broadcastRoundState(*updated)
+	// 预计算耗时随白名单人数增长，放到后台；未命中时 userSlicePayloads 会现算
+	go s.precomputeSlicePayloads(rt)
+	s.seedRoundJoins(context.Background(), roundID)
+	// 开始后不再接受签到
+	s.closeCheckinSession(context.Background(), roundID)
+	// 团队赛在开始时按最终配置分队，锁定期间修改分队方式仍然生效
+	if updated.TeamMode != "" {
+		ctx := context.Background()
+		if members, err := s.Redis.SMembers(ctx, whitelistKey(roundID)).Result(); err == nil {
+			userIDs := make([]int64, 0, len(members))
+			for _, m := range members {
+				if uid, err := strconv.ParseInt(m, 10, 64); err == nil {
+					userIDs = append(userIDs, uid)
+				}
+			}
+			s.assignRoundTeams(ctx, &updated, userIDs)
+		}
+	}
+	s.broadcastRoundState(updated)
 
 	// 到点切换为 RUNNING
 	time.AfterFunc(time.Until(time.UnixMilli(startAt)), func() {
-		_ = s.setRoundStatus(roundID, models.RoundRunning)
-		if round, _ := s.getRoundByID(roundID); round != nil {
-			round.Seed = seed
-			round.StartAtMS = startAt
-			round.EndAtMS = endAt
-			if current := s.Game.GetCurrent(); current != nil && current.Round.ID == roundID {
-				current.Round.Status = models.RoundRunning
-				s.Game.SetCurrent(current)
-			}
-			s.broadcastRoundState(*round)
+		s.roundCtl.mu.Lock()
+		defer s.roundCtl.mu.Unlock()
+		round, _ := s.getRoundByID(roundID)
+		if round == nil {
+			return
 		}
-	})
-
-	// 游戏结束自动开奖
-	time.AfterFunc(time.Until(time.UnixMilli(endAt)), func() {
-		_ = s.setRoundStatus(roundID, models.RoundReadyDraw)
-		if round, _ := s.getRoundByID(roundID); round != nil {
-			if current := s.Game.GetCurrent(); current != nil && current.Round.ID == roundID {
-				current.Round.Status = models.RoundReadyDraw
-				s.Game.SetCurrent(current)
-			}
-			s.broadcastRoundState(*round)
+		// 倒计时期间被中止时状态机拒绝迁移
+		if err := s.transitionRound(s.DB, round, models.RoundRunning, actorSystem, "countdown finished", ""); err != nil {
+			return
 		}
+		s.syncRuntimeStatus(roundID, models.RoundRunning)
+		s.broadcastRoundState(*round)
+		s.startLeaderboardPush(roundID)
 	})
 
-	c.JSON(http.StatusOK, gin.H{"status": "countdown", "start_at": startAt})
+	// 游戏结束进入待开奖（暂停/延长/提前结束时会重新安排）
+	s.scheduleRoundEnd(roundID, endAt)
+	return startAt, nil
 }
 
 func (s *Server) DrawRound(c *gin.Context) {
@@ -418,14 +457,14 @@ func (s *Server) DrawRound(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	if err := s.DrawRoundByID(roundID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := s.DrawRoundByID(roundID, adminOperator(c)); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "drawn"})
 }
 
-func (s *Server) DrawRoundByID(roundID int64) error {
+func (s *Server) DrawRoundByID(roundID int64, actor string) error {
 	ctx := context.Background()
 
 	// [FIX-5] 并发安全：添加分布式锁防止重复开奖
@@ -435,7 +474,7 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 		return fmt.Errorf("redis lock error: %w", err)
 	}
 	if !locked {
-		return errors.New("开奖正在进行中，请勿重复操作")
+		return errDrawInProgress
 	}
 	defer s.Redis.Del(ctx, lockKey)
 
@@ -446,28 +485,28 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 	if round.Status == models.RoundPendingConfirm || round.Status == models.RoundFinished {
 		return nil
 	}
-	if round.Status != models.RoundReadyDraw && round.Status != models.RoundRunning {
-		return errors.New("round not ready for draw")
-	}
-
-	_ = s.setRoundStatus(roundID, models.RoundDrawing)
-	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
-		rt.Round.Status = models.RoundDrawing
-		s.Game.SetCurrent(rt)
-	}
-	if round != nil {
-		round.Status = models.RoundDrawing
-		s.broadcastRoundState(*round)
+	if err := s.transitionRound(s.DB, round, models.RoundDrawing, actor, "", ""); err != nil {
+		return err
 	}
+	s.syncRuntimeStatus(roundID, models.RoundDrawing)
+	s.broadcastRoundState(*round)
 
 	scores, err := s.Redis.ZRangeWithScores(ctx, scoreZSetKey(roundID), 0, -1).Result()
 	if err != nil {
 		return err
 	}
+	excluded, err := s.roundExclusions(roundID)
+	if err != nil {
+		return err
+	}
 
 	scoreMap := make(map[int64]int)
 	for _, sc := range scores {
 		uid := parseUserID(sc.Member)
+		// 管理员排除的用户不参与开奖
+		if _, ok := excluded[uid]; ok {
+			continue
+		}
 		val := int(sc.Score)
 		if val < 0 {
 			val = 0
@@ -481,6 +520,8 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 		Amount      int64
 		BaseAmount  int64
 		LuckyAmount int64
+		Team        string
+		TeamAmount  int64
 		baseFrac    float64 // 用于最大余数法
 		luckyFrac   float64 // 用于最大余数法
 	}
@@ -492,6 +533,26 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 		allocs = append(allocs, alloc{UserID: uid, Score: sc})
 	}
 
+	// 团队赛：先按 team_ratio 划出团队奖池，其余按个人规则分配
+	individualPool := round.TotalPool
+	if round.TeamMode != "" {
+		teamOf := s.roundTeams(ctx, roundID)
+		teams := make([]string, len(allocs))
+		teamScores := make([]int, len(allocs))
+		for i := range allocs {
+			allocs[i].Team = teamOf[allocs[i].UserID]
+			teams[i] = allocs[i].Team
+			teamScores[i] = allocs[i].Score
+		}
+		if round.TeamRatio > 0 {
+			amounts, used := allocateTeamPool(round.TotalPool*int64(round.TeamRatio)/100, round.TeamTopN, teams, teamScores)
+			for i := range allocs {
+				allocs[i].TeamAmount = amounts[i]
+			}
+			individualPool -= used
+		}
+	}
+
 	alpha := 1.4
 	luckyRatio := round.LuckyRatio
 	baseRatio := round.BaseRatio
@@ -515,9 +576,11 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 		baseRatio = 60
 	}
 	// luckyPool 先算，basePool 取剩余，避免精度丢失
-	luckyPool := round.TotalPool * int64(luckyRatio) / int64(totalRatio)
-	basePool := round.TotalPool - luckyPool
+	luckyPool := individualPool * int64(luckyRatio) / int64(totalRatio)
+	basePool := individualPool - luckyPool
 
+	// PRORATE 策略下按在场时长折算基础池与幸运池权重，团队池不受影响
+	presence := s.presenceFactors(ctx, *round)
 	weights := make([]float64, len(allocs))
 	totalWeight := 0.0
 	for i, a := range allocs {
@@ -525,6 +588,9 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 			continue
 		}
 		w := math.Pow(float64(a.Score), alpha)
+		if f, ok := presence[a.UserID]; ok {
+			w *= f
+		}
 		weights[i] = w
 		totalWeight += w
 	}
@@ -620,7 +686,7 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 	}
 
 	for i := range allocs {
-		allocs[i].Amount = allocs[i].BaseAmount + allocs[i].LuckyAmount
+		allocs[i].Amount = allocs[i].BaseAmount + allocs[i].LuckyAmount + allocs[i].TeamAmount
 	}
 
 	// [FIX-4] 优化尾差补偿：按权重比例分配给所有用户（最大余数法已处理大部分，这里是最终校验）
@@ -658,40 +724,48 @@ func (s *Server) DrawRoundByID(roundID int64) error {
 		return err
 	}
 	batchID, _ := res.LastInsertId()
-	stmt, err := tx.Prepare(`INSERT INTO award_details (batch_id, user_id, score, amount, base_amount, lucky_amount, created_at) VALUES (?, ?, ?, ?, ?, ?, NOW())`)
+	stmt, err := tx.Prepare(`INSERT INTO award_details (batch_id, user_id, score, amount, base_amount, lucky_amount, team, team_amount, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())`)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 	for _, a := range allocs {
-		if _, err := stmt.Exec(batchID, a.UserID, a.Score, a.Amount, a.BaseAmount, a.LuckyAmount); err != nil {
+		if _, err := stmt.Exec(batchID, a.UserID, a.Score, a.Amount, a.BaseAmount, a.LuckyAmount, a.Team, a.TeamAmount); err != nil {
 			_ = tx.Rollback()
 			return err
 		}
-		// 单个用户推送结果
-		payload := mustJSON(WSMessage{Type: "round_drawn", Data: map[string]interface{}{
-			"round_id":     roundID,
-			"score":        a.Score,
-			"amount":       a.Amount,
-			"base_amount":  a.BaseAmount,
-			"lucky_amount": a.LuckyAmount,
-		}})
-		s.Hub.SendToUser(a.UserID, payload)
-	}
-	if _, err := tx.Exec(`UPDATE rounds SET status=?, updated_at=NOW() WHERE id=?`, models.RoundPendingConfirm, roundID); err != nil {
+	}
+	if err := s.transitionRound(tx, round, models.RoundPendingConfirm, actor, fmt.Sprintf("batch #%d", batchID), ""); err != nil {
 		_ = tx.Rollback()
 		return err
 	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
-	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
-		rt.Round.Status = models.RoundPendingConfirm
-		s.Game.SetCurrent(rt)
-	}
+	s.syncRuntimeStatus(roundID, models.RoundPendingConfirm)
+	// 单个用户推送结果，与 DRAWING 状态走同一推送队列以保证先后顺序
+	drawn := allocs
+	s.enqueueBroadcast(func() {
+		for _, a := range drawn {
+			s.Hub.SendToUser(a.UserID, mustJSON(WSMessage{Type: "round_drawn", Data: map[string]interface{}{
+				"round_id":     roundID,
+				"score":        a.Score,
+				"amount":       a.Amount,
+				"base_amount":  a.BaseAmount,
+				"lucky_amount": a.LuckyAmount,
+				"team":         a.Team,
+				"team_amount":  a.TeamAmount,
+			}}))
+		}
+	})
 	if round, _ := s.getRoundByID(roundID); round != nil {
 		s.broadcastRoundState(*round)
+		results := make([]screenResultItem, 0, len(allocs))
+		for _, a := range allocs {
+			results = append(results, screenResultItem{UserID: a.UserID, Score: a.Score, Amount: a.Amount})
+		}
+		s.broadcastScreenResult(*round, results)
 	}
 	return nil
 }
@@ -717,7 +791,7 @@ func (s *Server) DeleteRound(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
 		return
 	}
-	if round.Status != models.RoundWaiting && round.Status != models.RoundLocked {
+	if round.Status != models.RoundWaiting && round.Status != models.RoundLocked && round.Status != models.RoundAborted {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "round already started"})
 		return
 	}
@@ -740,6 +814,31 @@ func (s *Server) DeleteRound(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
+	if _, err := tx.Exec(`DELETE FROM round_exclusions WHERE round_id = ?`, roundID); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM round_checkins WHERE round_id = ?`, roundID); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM round_adjustments WHERE round_id = ?`, roundID); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM round_status_history WHERE round_id = ?`, roundID); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM round_agenda WHERE round_id = ?`, roundID); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
 	if _, err := tx.Exec(`DELETE FROM rounds WHERE id = ?`, roundID); err != nil {
 		_ = tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
@@ -751,7 +850,10 @@ func (s *Server) DeleteRound(c *gin.Context) {
 	}
 	if s.Redis != nil {
 		ctx := context.Background()
-		_ = s.Redis.Del(ctx, whitelistKey(roundID), scoreZSetKey(roundID), scoreSumKey(roundID), clickStreamKey(roundID)).Err()
+		s.closeCheckinSession(ctx, roundID)
+		_ = s.Redis.Del(ctx, whitelistKey(roundID), scoreZSetKey(roundID), scoreSumKey(roundID), clickStreamKey(roundID), roundPresentKey(roundID), clickNonceKey(roundID),
+			teamsKey(roundID), teamScoreKey(roundID), roundJoinedKey(roundID),
+			abortedArchiveKey(roundID, "scores"), abortedArchiveKey(roundID, "score_sum"), abortedArchiveKey(roundID, "clicks"), abortedArchiveKey(roundID, "team_scores")).Err()
 	}
 	s.broadcastClearScreen(roundID, "deleted")
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
@@ -763,7 +865,7 @@ func (s *Server) ConfirmAward(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	if err := s.confirmAwardBatchWithRetry(batchID, 1); err != nil {
+	if err := s.confirmAwardBatchWithRetry(batchID, adminOperator(c), 1); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -804,30 +906,40 @@ func (s *Server) VoidAwardBatch(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
-	_, _ = tx.Exec(`UPDATE rounds SET status=? WHERE id=? AND status IN (?, ?)`, models.RoundReadyDraw, roundID, models.RoundPendingConfirm, models.RoundDrawing)
-	if err := tx.Commit(); err != nil {
+	round, err := scanRound(tx.QueryRow(`SELECT `+roundColumns+` FROM rounds WHERE id = ? FOR UPDATE`, roundID))
+	if err != nil {
+		_ = tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
 	}
-	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
-		if rt.Round.Status == models.RoundPendingConfirm || rt.Round.Status == models.RoundDrawing {
-			rt.Round.Status = models.RoundReadyDraw
-			s.Game.SetCurrent(rt)
+	// 作废后轮次回到待开奖，可重新开奖
+	if round.Status == models.RoundPendingConfirm || round.Status == models.RoundDrawing {
+		if err := s.transitionRound(tx, round, models.RoundReadyDraw, adminOperator(c), fmt.Sprintf("void batch #%d", batchID), ""); err != nil {
+			_ = tx.Rollback()
+			c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+			return
 		}
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if round.Status == models.RoundReadyDraw {
+		s.syncRuntimeStatus(roundID, models.RoundReadyDraw)
+	}
 	if round, _ := s.getRoundByID(roundID); round != nil {
 		s.broadcastRoundState(*round)
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "void"})
 }
 
-func (s *Server) confirmAwardBatchWithRetry(batchID int64, retry int) error {
-	err := s.confirmAwardBatch(batchID)
+func (s *Server) confirmAwardBatchWithRetry(batchID int64, actor string, retry int) error {
+	err := s.confirmAwardBatch(batchID, actor)
 	if err == nil {
 		return nil
 	}
 	if retry > 0 && isBadConn(err) {
-		return s.confirmAwardBatchWithRetry(batchID, retry-1)
+		return s.confirmAwardBatchWithRetry(batchID, actor, retry-1)
 	}
 	return err
 }
@@ -839,7 +951,7 @@ func isBadConn(err error) bool {
 	return strings.Contains(err.Error(), "bad connection")
 }
 
-func (s *Server) confirmAwardBatch(batchID int64) error {
+func (s *Server) confirmAwardBatch(batchID int64, actor string) error {
 	tx, err := s.DB.Begin()
 	if err != nil {
 		return err
@@ -904,17 +1016,21 @@ func (s *Server) confirmAwardBatch(batchID int64) error {
 		_ = tx.Rollback()
 		return err
 	}
-	if _, err := tx.Exec(`UPDATE rounds SET status=?, updated_at=NOW() WHERE id=?`, models.RoundFinished, roundID); err != nil {
+	round, err := scanRound(tx.QueryRow(`SELECT `+roundColumns+` FROM rounds WHERE id = ? FOR UPDATE`, roundID))
+	if err != nil {
 		_ = tx.Rollback()
 		return err
 	}
+	if round.Status != models.RoundFinished {
+		if err := s.transitionRound(tx, round, models.RoundFinished, actor, fmt.Sprintf("batch #%d", batchID), ""); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
-	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
-		rt.Round.Status = models.RoundFinished
-		s.Game.SetCurrent(rt)
-	}
+	s.syncRuntimeStatus(roundID, models.RoundFinished)
 	if round, _ := s.getRoundByID(roundID); round != nil {
 		s.broadcastRoundState(*round)
 	}
@@ -950,9 +1066,7 @@ func (s *Server) ListRounds(c *gin.Context) {
 			limit = parsed
 		}
 	}
-	rows, err := s.DB.Query(`SELECT id, title, total_pool, duration_sec, slice_ms, drops_per_slice, bombs_per_slice, bigs_per_slice, empty_per_slice, big_multiplier, max_speed, drop_visible_ms,
-		score_total, bomb_penalty, min_award, max_award, lucky_ratio, base_ratio, tail_top_n, rank_segments, status, start_at_ms, end_at_ms, created_at
-		FROM rounds ORDER BY id DESC LIMIT ?`, limit)
+	rows, err := s.DB.Query(`SELECT `+roundColumns+` FROM rounds ORDER BY id DESC LIMIT ?`, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
 		return
@@ -960,39 +1074,45 @@ func (s *Server) ListRounds(c *gin.Context) {
 	defer rows.Close()
 	items := make([]gin.H, 0)
 	for rows.Next() {
-		var r models.Round
-		var status string
-		var created time.Time
-		if err := rows.Scan(&r.ID, &r.Title, &r.TotalPool, &r.DurationSec, &r.SliceMS, &r.DropsPerSlice, &r.BombsPerSlice, &r.BigsPerSlice, &r.EmptyPerSlice, &r.BigMultiplier, &r.MaxSpeed, &r.DropVisibleMS,
-			&r.ScoreTotal, &r.BombPenalty, &r.MinAward, &r.MaxAward, &r.LuckyRatio, &r.BaseRatio, &r.TailTopN, &r.RankSegments, &status, &r.StartAtMS, &r.EndAtMS, &created); err == nil {
-			r.Status = models.RoundStatus(status)
-			items = append(items, gin.H{
-				"id":              r.ID,
-				"title":           r.Title,
-				"total_pool":      r.TotalPool,
-				"duration_sec":    r.DurationSec,
-				"slice_ms":        r.SliceMS,
-				"drops_per_slice": r.DropsPerSlice,
-				"bombs_per_slice": r.BombsPerSlice,
-				"bigs_per_slice":  r.BigsPerSlice,
-				"empty_per_slice": r.EmptyPerSlice,
-				"big_multiplier":  r.BigMultiplier,
-				"max_speed":       r.MaxSpeed,
-				"drop_visible_ms": r.DropVisibleMS,
-				"score_total":     r.ScoreTotal,
-				"bomb_penalty":    r.BombPenalty,
-				"min_award":       r.MinAward,
-				"max_award":       r.MaxAward,
-				"lucky_ratio":     r.LuckyRatio,
-				"base_ratio":      r.BaseRatio,
-				"tail_top_n":      r.TailTopN,
-				"rank_segments":   r.RankSegments,
-				"status":          r.Status,
-				"start_at":        r.StartAtMS,
-				"end_at":          r.EndAtMS,
-				"created_at":      created,
-			})
+		r, err := scanRound(rows)
+		if err != nil {
+			continue
 		}
+		items = append(items, gin.H{
+			"id":                      r.ID,
+			"title":                   r.Title,
+			"total_pool":              r.TotalPool,
+			"duration_sec":            r.DurationSec,
+			"slice_ms":                r.SliceMS,
+			"drops_per_slice":         r.DropsPerSlice,
+			"bombs_per_slice":         r.BombsPerSlice,
+			"bigs_per_slice":          r.BigsPerSlice,
+			"empty_per_slice":         r.EmptyPerSlice,
+			"big_multiplier":          r.BigMultiplier,
+			"max_speed":               r.MaxSpeed,
+			"drop_visible_ms":         r.DropVisibleMS,
+			"score_total":             r.ScoreTotal,
+			"bomb_penalty":            r.BombPenalty,
+			"min_award":               r.MinAward,
+			"max_award":               r.MaxAward,
+			"lucky_ratio":             r.LuckyRatio,
+			"base_ratio":              r.BaseRatio,
+			"tail_top_n":              r.TailTopN,
+			"rank_segments":           r.RankSegments,
+			"leaderboard_interval_ms": r.LeaderboardIntervalMS,
+			"leaderboard_top_n":       r.LeaderboardTopN,
+			"team_mode":               r.TeamMode,
+			"team_count":              r.TeamCount,
+			"team_ratio":              r.TeamRatio,
+			"team_top_n":              r.TeamTopN,
+			"late_join":               r.LateJoin,
+			"late_join_sec":           r.LateJoinSec,
+			"template_id":             r.TemplateID,
+			"status":                  r.Status,
+			"start_at":                r.StartAtMS,
+			"end_at":                  r.EndAtMS,
+			"created_at":              r.CreatedAt,
+		})
 	}
 	c.JSON(http.StatusOK, gin.H{"items": items})
 }
@@ -1021,13 +1141,15 @@ func (s *Server) GetRoundResults(c *gin.Context) {
 		tokens = tokens[:6]
 	}
 
-	baseSQL := `SELECT ad.user_id, u.phone, u.nickname, ad.score, ad.amount, ad.base_amount, ad.lucky_amount,
+	baseSQL := `SELECT ad.user_id, u.phone, u.nickname, COALESCE(e.name, '') AS real_name, COALESCE(NULLIF(e.department, ''), u.department) AS department,
+		ad.score, ad.amount, ad.base_amount, ad.lucky_amount, ad.team, ad.team_amount,
 		ROW_NUMBER() OVER (ORDER BY ad.score DESC, ad.user_id ASC) AS r
 		FROM award_details ad
 		JOIN award_batches ab ON ad.batch_id = ab.id
 		JOIN users u ON ad.user_id = u.id
+		LEFT JOIN roster_employees e ON e.user_id = u.id
 		WHERE ab.round_id = ? AND ab.status <> 'VOID'`
-	query := "SELECT t.user_id, t.phone, t.nickname, t.score, t.amount, t.base_amount, t.lucky_amount, t.r FROM (" + baseSQL + ") t"
+	query := "SELECT t.user_id, t.phone, t.nickname, t.real_name, t.department, t.score, t.amount, t.base_amount, t.lucky_amount, t.team, t.team_amount, t.r FROM (" + baseSQL + ") t"
 	countQuery := "SELECT COUNT(1) FROM (" + baseSQL + ") t"
 	args := []interface{}{roundID}
 	whereArgs := make([]interface{}, 0)
@@ -1038,9 +1160,9 @@ func (s *Server) GetRoundResults(c *gin.Context) {
 			if token == "" {
 				continue
 			}
-			conds = append(conds, "(t.phone LIKE ? OR t.nickname LIKE ? OR t.user_id = ?)")
+			conds = append(conds, "(t.phone LIKE ? OR t.nickname LIKE ? OR t.real_name LIKE ? OR t.department LIKE ? OR t.user_id = ?)")
 			like := "%" + token + "%"
-			whereArgs = append(whereArgs, like, like)
+			whereArgs = append(whereArgs, like, like, like, like)
 			if uid, err := strconv.ParseInt(token, 10, 64); err == nil {
 				whereArgs = append(whereArgs, uid)
 			} else {
@@ -1077,24 +1199,32 @@ func (s *Server) GetRoundResults(c *gin.Context) {
 		UserID      int64
 		Phone       string
 		Nickname    string
+		RealName    string
+		Department  string
 		Score       int
 		Amount      int64
 		BaseAmount  int64
 		LuckyAmount int64
+		Team        string
+		TeamAmount  int64
 		Rank        int64
 	}
 	items := make([]gin.H, 0)
 	for rows.Next() {
 		var it resultItem
-		if err := rows.Scan(&it.UserID, &it.Phone, &it.Nickname, &it.Score, &it.Amount, &it.BaseAmount, &it.LuckyAmount, &it.Rank); err == nil {
+		if err := rows.Scan(&it.UserID, &it.Phone, &it.Nickname, &it.RealName, &it.Department, &it.Score, &it.Amount, &it.BaseAmount, &it.LuckyAmount, &it.Team, &it.TeamAmount, &it.Rank); err == nil {
 			items = append(items, gin.H{
 				"user_id":      it.UserID,
 				"phone":        it.Phone,
 				"nickname":     it.Nickname,
+				"real_name":    it.RealName,
+				"department":   it.Department,
 				"score":        it.Score,
 				"amount":       it.Amount,
 				"base_amount":  it.BaseAmount,
 				"lucky_amount": it.LuckyAmount,
+				"team":         it.Team,
+				"team_amount":  it.TeamAmount,
 				"rank":         it.Rank,
 			})
 		}
@@ -1102,11 +1232,16 @@ func (s *Server) GetRoundResults(c *gin.Context) {
 	var scoreSum int64
 	var scoreUsers int64
 	_ = s.DB.QueryRow(`SELECT COALESCE(SUM(ad.score),0), COUNT(1) FROM award_details ad JOIN award_batches ab ON ad.batch_id = ab.id WHERE ab.round_id = ? AND ab.status <> 'VOID'`, roundID).Scan(&scoreSum, &scoreUsers)
+	adjustments, err := s.roundAdjustments(roundID)
+	if err != nil {
+		adjustments = []roundAdjustment{}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"items":       items,
 		"total":       total,
 		"score_sum":   scoreSum,
 		"score_users": scoreUsers,
+		"adjustments": adjustments,
 	})
 }
 
@@ -1116,10 +1251,12 @@ func (s *Server) ExportRound(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	rows, err := s.DB.Query(`SELECT u.id, u.phone, ad.score, ad.amount, ad.base_amount, ad.lucky_amount
+	rows, err := s.DB.Query(`SELECT u.id, u.phone, ad.score, ad.amount, ad.base_amount, ad.lucky_amount, ad.team, ad.team_amount,
+		COALESCE(e.name, ''), COALESCE(NULLIF(e.department, ''), u.department), COALESCE(e.employee_no, '')
 		FROM award_details ad
 		JOIN award_batches ab ON ad.batch_id = ab.id
 		JOIN users u ON ad.user_id = u.id
+		LEFT JOIN roster_employees e ON e.user_id = u.id
 		WHERE ab.round_id = ? AND ab.status <> 'VOID' ORDER BY ad.score DESC`, roundID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
@@ -1129,16 +1266,42 @@ func (s *Server) ExportRound(c *gin.Context) {
 	filename := fmt.Sprintf("round_%d_export.csv", roundID)
 	c.Header("Content-Type", "text/csv; charset=utf-8")
 	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
-	_, _ = c.Writer.WriteString("user_id,phone,score,base_amount_fen,lucky_amount_fen,bonus_amount_fen,amount_fen\n")
+	adjustTotals := s.roundScoreAdjustTotals(roundID)
+	excluded, _ := s.roundExclusions(roundID)
+	// 姓名、部门为自由文本，交给 csv.Writer 转义
+	w := csv.NewWriter(c.Writer)
+	defer w.Flush()
+	_ = w.Write([]string{"user_id", "phone", "score", "base_amount_fen", "lucky_amount_fen", "bonus_amount_fen", "amount_fen", "score_adjust", "excluded", "name", "department", "employee_no", "team", "team_amount_fen"})
 	for rows.Next() {
 		var uid int64
-		var phone string
+		var phone, team, name, department, employeeNo string
 		var score int
-		var amount, baseAmount, luckyAmount int64
-		if err := rows.Scan(&uid, &phone, &score, &amount, &baseAmount, &luckyAmount); err == nil {
-			bonus := amount - baseAmount - luckyAmount
-			line := fmt.Sprintf("%d,%s,%d,%d,%d,%d,%d\n", uid, phone, score, baseAmount, luckyAmount, bonus, amount)
-			_, _ = c.Writer.WriteString(line)
+		var amount, baseAmount, luckyAmount, teamAmount int64
+		if err := rows.Scan(&uid, &phone, &score, &amount, &baseAmount, &luckyAmount, &team, &teamAmount, &name, &department, &employeeNo); err == nil {
+			bonus := amount - baseAmount - luckyAmount - teamAmount
+			_ = w.Write([]string{
+				strconv.FormatInt(uid, 10), phone, strconv.Itoa(score),
+				strconv.FormatInt(baseAmount, 10), strconv.FormatInt(luckyAmount, 10), strconv.FormatInt(bonus, 10), strconv.FormatInt(amount, 10),
+				strconv.Itoa(adjustTotals[uid]), "0", name, department, employeeNo, team, strconv.FormatInt(teamAmount, 10),
+			})
+		}
+	}
+	// 被排除的用户不在开奖明细中，单独追加（金额为 0）
+	if len(excluded) > 0 {
+		ids := make([]int64, 0, len(excluded))
+		for uid := range excluded {
+			ids = append(ids, uid)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		infoMap := s.getUsersByIDs(ids)
+		teamOf := s.roundTeams(context.Background(), roundID)
+		for _, uid := range ids {
+			score, _ := s.Redis.ZScore(context.Background(), scoreZSetKey(roundID), scoreMember(uid)).Result()
+			info := infoMap[uid]
+			_ = w.Write([]string{
+				strconv.FormatInt(uid, 10), info.Phone, strconv.Itoa(int(score)), "0", "0", "0", "0",
+				strconv.Itoa(adjustTotals[uid]), "1", info.RealName, info.Department, info.EmployeeNo, teamOf[uid], "0",
+			})
 		}
 	}
 }
@@ -1195,6 +1358,10 @@ func (s *Server) GetMetrics(c *gin.Context) {
 		"qps_1s":       qps1s,
 		"score_sum":    scoreSum,
 		"score_users":  scoreUsers,
+		"click_rate_limited": gin.H{
+			"user": s.clickLimit.userLimited.Load(),
+			"ip":   s.clickLimit.ipLimited.Load(),
+		},
 	})
 }
 
@@ -1241,30 +1408,7 @@ func (s *Server) GetLeaderboard(c *gin.Context) {
 			userIDs = append(userIDs, uid)
 		}
 	}
-	type userInfo struct {
-		Phone     string
-		Nickname  string
-		AvatarURL string
-	}
-	infoMap := map[int64]userInfo{}
-	if len(userIDs) > 0 {
-		query := `SELECT id, phone, nickname, avatar_url FROM users WHERE id IN (` + strings.TrimRight(strings.Repeat("?,", len(userIDs)), ",") + `)`
-		args := make([]interface{}, len(userIDs))
-		for i, v := range userIDs {
-			args[i] = v
-		}
-		rows, err := s.DB.Query(query, args...)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var id int64
-				var phone, nickname, avatarURL string
-				if err := rows.Scan(&id, &phone, &nickname, &avatarURL); err == nil {
-					infoMap[id] = userInfo{Phone: phone, Nickname: nickname, AvatarURL: avatarURL}
-				}
-			}
-		}
-	}
+	infoMap := s.getUsersByIDs(userIDs)
 	resp := make([]gin.H, 0, len(items))
 	for _, item := range items {
 		uid := parseUserID(item.Member)
@@ -1273,6 +1417,8 @@ func (s *Server) GetLeaderboard(c *gin.Context) {
 			"user_id":    uid,
 			"phone":      info.Phone,
 			"nickname":   info.Nickname,
+			"real_name":  info.RealName,
+			"department": info.Department,
 			"avatar_url": info.AvatarURL,
 			"score":      int(item.Score),
 		})
@@ -1283,30 +1429,7 @@ func (s *Server) GetLeaderboard(c *gin.Context) {
 func (s *Server) GetOnlineUsers(c *gin.Context) {
 	ctx := context.Background()
 	active := s.getActiveOnlineUserIDs(ctx)
-	type userInfo struct {
-		Phone     string
-		Nickname  string
-		AvatarURL string
-	}
-	infoMap := map[int64]userInfo{}
-	if len(active) > 0 {
-		query := `SELECT id, phone, nickname, avatar_url FROM users WHERE id IN (` + strings.TrimRight(strings.Repeat("?,", len(active)), ",") + `)`
-		args := make([]interface{}, len(active))
-		for i, v := range active {
-			args[i] = v
-		}
-		rows, err := s.DB.Query(query, args...)
-		if err == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var id int64
-				var phone, nickname, avatarURL string
-				if err := rows.Scan(&id, &phone, &nickname, &avatarURL); err == nil {
-					infoMap[id] = userInfo{Phone: phone, Nickname: nickname, AvatarURL: avatarURL}
-				}
-			}
-		}
-	}
+	infoMap := s.getUsersByIDs(active)
 	resp := make([]gin.H, 0, len(active))
 	for _, uid := range active {
 		info := infoMap[uid]
@@ -1320,38 +1443,6 @@ func (s *Server) GetOnlineUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"items": resp})
 }
 
-func (s *Server) getActiveOnlineUserIDs(ctx context.Context) []int64 {
-	// 使用 HGetAll 一次性获取所有在线用户时间戳，避免 O(N) 次 Redis 请求
-	tsMap, err := s.Redis.HGetAll(ctx, onlineUsersKey()).Result()
-	if err != nil {
-		return nil
-	}
-	now := time.Now().UnixMilli()
-	active := make([]int64, 0, len(tsMap))
-	expired := make([]string, 0)
-
-	for idStr, tsStr := range tsMap {
-		uid, _ := strconv.ParseInt(idStr, 10, 64)
-		ts, _ := strconv.ParseInt(tsStr, 10, 64)
-		if ts > 0 && now-ts <= 20000 {
-			active = append(active, uid)
-		} else {
-			expired = append(expired, idStr)
-		}
-	}
-
-	// 使用 Pipeline 批量清理过期用户
-	if len(expired) > 0 {
-		pipe := s.Redis.Pipeline()
-		for _, idStr := range expired {
-			pipe.SRem(ctx, onlineUserIDsKey(), idStr)
-			pipe.HDel(ctx, onlineUsersKey(), idStr)
-		}
-		_, _ = pipe.Exec(ctx)
-	}
-	return active
-}
-
 func (s *Server) calcQPS(roundID int64, nowMS int64) (int, int) {
 	ctx := context.Background()
 	sec := nowMS / 1000
@@ -1368,69 +1459,6 @@ func (s *Server) calcQPS(roundID int64, nowMS int64) (int, int) {
 	return int(total / 5), int(last)
 }
 
-func (s *Server) broadcastRoundState(round models.Round) {
-	rt := s.Game.GetCurrent()
-	var slices []game.SliceRuntime
-	revealSalt := ""
-	if rt != nil && rt.Round.ID == round.ID {
-		slices = rt.Slices
-		revealSalt = rt.RevealSalt
-	}
-	ctx := context.Background()
-	onlineCount := len(s.getActiveOnlineUserIDs(ctx))
-	whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
-	userIDs := s.Hub.UserIDs()
-	if len(userIDs) == 0 {
-		payload := mustJSON(WSMessage{
-			Type: "round_state",
-			Data: roundStatePayload(round, slices, revealSalt, nil, onlineCount, int(whitelistCount), 0),
-		})
-		s.Hub.Broadcast(payload)
-		return
-	}
-
-	// 批量查询白名单状态 (使用 SMIsMember 一次性查询)
-	whitelistKey := whitelistKey(round.ID)
-	members := make([]interface{}, len(userIDs))
-	for i, uid := range userIDs {
-		members[i] = uid
-	}
-	eligibleMap := make(map[int64]bool, len(userIDs))
-
-	// SMIsMember 批量检查 (Redis 6.2+)
-	results, err := s.Redis.SMIsMember(ctx, whitelistKey, members...).Result()
-	if err == nil && len(results) == len(userIDs) {
-		for i, uid := range userIDs {
-			eligibleMap[uid] = results[i]
-		}
-	} else {
-		// 回退：使用 Pipeline 批量查询
-		pipe := s.Redis.Pipeline()
-		cmds := make([]*redis.BoolCmd, len(userIDs))
-		for i, uid := range userIDs {
-			cmds[i] = pipe.SIsMember(ctx, whitelistKey, uid)
-		}
-		_, _ = pipe.Exec(ctx)
-		for i, uid := range userIDs {
-			eligibleMap[uid] = cmds[i].Val()
-		}
-	}
-
-	// 其他状态：按白名单分组发送
-	for _, uid := range userIDs {
-		eligible := eligibleMap[uid]
-		payloadRound := round
-		if !eligible {
-			payloadRound.Status = models.RoundLocked
-		}
-		payload := mustJSON(WSMessage{
-			Type: "round_state",
-			Data: roundStatePayload(payloadRound, slices, revealSalt, &eligible, onlineCount, int(whitelistCount), uid),
-		})
-		s.Hub.SendToUser(uid, payload)
-	}
-}
-
 func (s *Server) broadcastClearScreen(roundID int64, reason string) {
 	payload := mustJSON(WSMessage{
 		Type: "clear_screen",
@@ -1439,7 +1467,9 @@ func (s *Server) broadcastClearScreen(roundID int64, reason string) {
 			"reason":   reason,
 		},
 	})
-	s.Hub.Broadcast(payload)
+	s.enqueueBroadcast(func() {
+		s.Hub.Broadcast(payload)
+	})
 }
 
 func (s *Server) clearRoundCache(roundID int64) {
@@ -1447,28 +1477,39 @@ func (s *Server) clearRoundCache(roundID int64) {
 		return
 	}
 	ctx := context.Background()
-	_ = s.Redis.Del(ctx, scoreZSetKey(roundID), scoreSumKey(roundID), clickStreamKey(roundID)).Err()
+	_ = s.Redis.Del(ctx, scoreZSetKey(roundID), scoreSumKey(roundID), clickStreamKey(roundID), teamsKey(roundID), teamScoreKey(roundID), roundJoinedKey(roundID)).Err()
 }
 
-func (s *Server) getRoundByID(id int64) (*models.Round, error) {
-	row := s.DB.QueryRow(`SELECT id, title, total_pool, duration_sec, slice_ms, drops_per_slice, bombs_per_slice, bigs_per_slice, empty_per_slice, big_multiplier, max_speed, drop_visible_ms,
-		score_total, bomb_penalty, min_award, max_award, lucky_ratio, base_ratio, tail_top_n, rank_segments, status, start_at_ms, end_at_ms, seed, created_at, updated_at
-		FROM rounds WHERE id = ?`, id)
+const roundColumns = `id, title, total_pool, duration_sec, slice_ms, drops_per_slice, bombs_per_slice, bigs_per_slice, empty_per_slice, big_multiplier, max_speed, drop_visible_ms,
+		score_total, bomb_penalty, min_award, max_award, lucky_ratio, base_ratio, tail_top_n, rank_segments, leaderboard_interval_ms, leaderboard_top_n,
+		template_id, team_mode, team_count, team_ratio, team_top_n, late_join, late_join_sec, status, start_at_ms, end_at_ms, paused_at_ms, seed, abort_reason, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRound(row rowScanner) (*models.Round, error) {
 	var r models.Round
 	var status string
 	if err := row.Scan(&r.ID, &r.Title, &r.TotalPool, &r.DurationSec, &r.SliceMS, &r.DropsPerSlice, &r.BombsPerSlice, &r.BigsPerSlice, &r.EmptyPerSlice, &r.BigMultiplier, &r.MaxSpeed, &r.DropVisibleMS,
-		&r.ScoreTotal, &r.BombPenalty, &r.MinAward, &r.MaxAward, &r.LuckyRatio, &r.BaseRatio, &r.TailTopN, &r.RankSegments, &status, &r.StartAtMS, &r.EndAtMS, &r.Seed, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		&r.ScoreTotal, &r.BombPenalty, &r.MinAward, &r.MaxAward, &r.LuckyRatio, &r.BaseRatio, &r.TailTopN, &r.RankSegments, &r.LeaderboardIntervalMS, &r.LeaderboardTopN,
+		&r.TemplateID, &r.TeamMode, &r.TeamCount, &r.TeamRatio, &r.TeamTopN, &r.LateJoin, &r.LateJoinSec, &status, &r.StartAtMS, &r.EndAtMS, &r.PausedAtMS, &r.Seed, &r.AbortReason, &r.CreatedAt, &r.UpdatedAt); err != nil {
 		return nil, err
 	}
 	r.Status = models.RoundStatus(status)
 	return &r, nil
 }
 
+func (s *Server) getRoundByID(id int64) (*models.Round, error) {
+	return scanRound(s.DB.QueryRow(`SELECT `+roundColumns+` FROM rounds WHERE id = ?`, id))
+}
+
 func (s *Server) ensureNoActiveRounds(excludeID int64) error {
 	statuses := []models.RoundStatus{
 		models.RoundLocked,
 		models.RoundCountdown,
 		models.RoundRunning,
+		models.RoundPaused,
 		models.RoundDrawing,
 	}
 	placeholders := strings.TrimRight(strings.Repeat("?,", len(statuses)), ",")
@@ -1487,12 +1528,24 @@ func (s *Server) ensureNoActiveRounds(excludeID int64) error {
 		}
 		return err
 	}
-	return fmt.Errorf("another round active: id=%d status=%s", id, status)
+	return fmt.Errorf("%w: id=%d status=%s", errRoundActive, id, status)
 }
 
-func (s *Server) setRoundStatus(roundID int64, status models.RoundStatus) error {
-	_, err := s.DB.Exec(`UPDATE rounds SET status=?, updated_at=NOW() WHERE id=?`, status, roundID)
-	return err
+// checkNoPendingRound 存在未开始且未排入议程的轮次时拒绝新建，失败时已写回响应
+func (s *Server) checkNoPendingRound(c *gin.Context) bool {
+	var pendingID int64
+	var pendingStatus string
+	row := s.DB.QueryRow(`SELECT id, status FROM rounds WHERE status IN (?, ?)
+		AND id NOT IN (SELECT round_id FROM round_agenda WHERE status = ?) ORDER BY id DESC LIMIT 1`,
+		models.RoundWaiting, models.RoundLocked, agendaScheduled)
+	if err := row.Scan(&pendingID, &pendingStatus); err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("已有未开始轮次：#%d (%s)，请先删除、开始该轮次或将其排入议程", pendingID, pendingStatus)})
+		return false
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return false
+	}
+	return true
 }
 
 func parseUserID(member interface{}) int64 {
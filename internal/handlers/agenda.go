@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+const (
+	agendaScheduled = "SCHEDULED"
+	agendaDone      = "DONE"
+	agendaFailed    = "FAILED"
+
+	agendaStepLock    = "LOCK"
+	agendaStepStart   = "START"
+	agendaStepDraw    = "DRAW"
+	agendaStepConfirm = "CONFIRM"
+
+	// 议程驱动的状态迁移在时间线中的操作人
+	actorAgenda = "agenda"
+
+	agendaTickInterval    = time.Second
+	agendaDefaultLockLead = 60 * time.Second
+	// 服务不可用等原因错过开始时间超过该值后不再补开，标记失败
+	agendaMissGrace       = 5 * time.Minute
+	agendaLockTTL         = 30 * time.Second
+	maxAgendaCountdownSec = 60
+)
+
+func agendaLockKey() string {
+	return "agenda:lock"
+}
+
+// releaseLockLua 仅当锁仍属于自己（值为本次写入的 token）时删除，避免超时后误删其它实例的锁
+var releaseLockLua = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+type agendaRequest struct {
+	RoundID      int64 `json:"round_id"`
+	LockAtMS     int64 `json:"lock_at"`
+	StartAtMS    int64 `json:"start_at"`
+	CountdownSec int   `json:"countdown_sec"`
+	AutoDraw     bool  `json:"auto_draw"`
+	AutoConfirm  bool  `json:"auto_confirm"`
+}
+
+// queryAgenda 读取议程条目（附带轮次标题与状态），where 作用于 round_agenda a
+func (s *Server) queryAgenda(where string, args ...interface{}) ([]models.AgendaItem, error) {
+	rows, err := s.DB.Query(`SELECT a.id, a.round_id, r.title, r.status, a.lock_at_ms, a.start_at_ms, a.countdown_sec, a.auto_draw, a.auto_confirm, a.status, a.last_step, a.last_error, a.operator, a.updated_at
+		FROM round_agenda a JOIN rounds r ON r.id = a.round_id
+		WHERE `+where+` ORDER BY a.start_at_ms ASC, a.id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]models.AgendaItem, 0)
+	for rows.Next() {
+		var it models.AgendaItem
+		var roundStatus string
+		if err := rows.Scan(&it.ID, &it.RoundID, &it.RoundTitle, &roundStatus, &it.LockAtMS, &it.StartAtMS, &it.CountdownSec, &it.AutoDraw, &it.AutoConfirm, &it.Status, &it.LastStep, &it.LastError, &it.Operator, &it.UpdatedAt); err != nil {
+			return nil, err
+		}
+		it.RoundStatus = models.RoundStatus(roundStatus)
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// ListAgenda 议程列表：未完成的条目与最近一天内完成的条目
+func (s *Server) ListAgenda(c *gin.Context) {
+	since := time.Now().Add(-24 * time.Hour).UnixMilli()
+	items, err := s.queryAgenda(`a.status <> ? OR a.start_at_ms >= ?`, agendaDone, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "server_time": time.Now().UnixMilli()})
+}
+
+// ScheduleRound 把未开始的轮次排入议程（同一轮次重复提交则覆盖并重置状态）
+func (s *Server) ScheduleRound(c *gin.Context) {
+	var req agendaRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RoundID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	now := time.Now().UnixMilli()
+	if req.StartAtMS <= now {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_at must be in the future"})
+		return
+	}
+	if req.CountdownSec <= 0 {
+		req.CountdownSec = 3
+	}
+	if req.CountdownSec > maxAgendaCountdownSec {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid countdown_sec"})
+		return
+	}
+	if req.LockAtMS <= 0 {
+		req.LockAtMS = req.StartAtMS - agendaDefaultLockLead.Milliseconds()
+	}
+	if req.LockAtMS > req.StartAtMS {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lock_at must not be after start_at"})
+		return
+	}
+	round, err := s.getRoundByID(req.RoundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if round.Status != models.RoundWaiting && round.Status != models.RoundLocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round already started"})
+		return
+	}
+
+	// 议程内各轮次从锁定到游戏结束的时间段不能重叠
+	endAt := req.StartAtMS + int64(req.CountdownSec+round.DurationSec)*1000
+	others, err := s.queryAgenda(`a.status = ? AND a.round_id <> ?`, agendaScheduled, req.RoundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	for _, other := range others {
+		otherRound, err := s.getRoundByID(other.RoundID)
+		if err != nil || otherRound == nil {
+			continue
+		}
+		otherEnd := other.StartAtMS + int64(other.CountdownSec+otherRound.DurationSec)*1000
+		if req.LockAtMS < otherEnd && other.LockAtMS < endAt {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("与议程中的轮次 #%d 时间重叠", other.RoundID)})
+			return
+		}
+	}
+
+	_, err = s.DB.Exec(`INSERT INTO round_agenda
+		(round_id, lock_at_ms, start_at_ms, countdown_sec, auto_draw, auto_confirm, status, last_step, last_error, operator, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, '', '', ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE lock_at_ms=VALUES(lock_at_ms), start_at_ms=VALUES(start_at_ms), countdown_sec=VALUES(countdown_sec),
+		auto_draw=VALUES(auto_draw), auto_confirm=VALUES(auto_confirm), status=VALUES(status), last_step='', last_error='', operator=VALUES(operator), updated_at=NOW()`,
+		req.RoundID, req.LockAtMS, req.StartAtMS, req.CountdownSec, req.AutoDraw, req.AutoConfirm, agendaScheduled, adminOperator(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": agendaScheduled, "round_id": req.RoundID, "lock_at": req.LockAtMS, "start_at": req.StartAtMS})
+}
+
+// RetryAgendaItem 失败的条目重新交给调度器
+func (s *Server) RetryAgendaItem(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	res, err := s.DB.Exec(`UPDATE round_agenda SET status=?, last_error='', operator=?, updated_at=NOW() WHERE id=? AND status=?`,
+		agendaScheduled, adminOperator(c), id, agendaFailed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agenda item not failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": agendaScheduled})
+}
+
+// DeleteAgendaItem 从议程移除，轮次本身保持当前状态
+func (s *Server) DeleteAgendaItem(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := s.DB.Exec(`DELETE FROM round_agenda WHERE id = ?`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// startAgendaScheduler 每秒检查议程，按时驱动锁定、开始、开奖与确认
+func (s *Server) startAgendaScheduler() {
+	if s == nil || s.DB == nil || s.Redis == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(agendaTickInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.runAgenda()
+		}
+	}()
+}
+
+func (s *Server) runAgenda() {
+	ctx := context.Background()
+	// 多实例部署时同一时刻只由一个实例驱动
+	token := newSessionID()
+	locked, err := s.Redis.SetNX(ctx, agendaLockKey(), token, agendaLockTTL).Result()
+	if err != nil || !locked {
+		return
+	}
+	defer releaseLockLua.Run(ctx, s.Redis, []string{agendaLockKey()}, token)
+
+	items, err := s.queryAgenda(`a.status = ?`, agendaScheduled)
+	if err != nil {
+		log.Printf("agenda load error: %v", err)
+		return
+	}
+	for _, item := range items {
+		s.advanceAgenda(item, time.Now().UnixMilli())
+	}
+}
+
+// advanceAgenda 根据轮次当前状态执行议程的下一步；管理员手动推进后从实际状态继续
+func (s *Server) advanceAgenda(item models.AgendaItem, now int64) {
+	round, err := s.getRoundByID(item.RoundID)
+	if err != nil || round == nil {
+		s.failAgenda(item, "", "round not found")
+		return
+	}
+	switch round.Status {
+	case models.RoundWaiting:
+		if now < item.LockAtMS || s.agendaMissed(item, now) {
+			return
+		}
+		s.finishAgendaStep(item, agendaStepLock, s.lockRound(round, actorAgenda))
+	case models.RoundLocked:
+		if now < item.StartAtMS || s.agendaMissed(item, now) {
+			return
+		}
+		_, err := s.startRound(round, item.CountdownSec, actorAgenda)
+		s.finishAgendaStep(item, agendaStepStart, err)
+	case models.RoundReadyDraw:
+		if item.AutoDraw {
+			s.finishAgendaStep(item, agendaStepDraw, s.DrawRoundByID(round.ID, actorAgenda))
+		} else if !item.AutoConfirm {
+			s.completeAgenda(item)
+		}
+	case models.RoundPendingConfirm:
+		if !item.AutoConfirm {
+			s.completeAgenda(item)
+			return
+		}
+		var batchID int64
+		err := s.DB.QueryRow(`SELECT id FROM award_batches WHERE round_id = ? AND status = ? ORDER BY id DESC LIMIT 1`, round.ID, models.RoundPendingConfirm).Scan(&batchID)
+		if err == nil {
+			err = s.confirmAwardBatchWithRetry(batchID, actorAgenda, 1)
+		}
+		s.finishAgendaStep(item, agendaStepConfirm, err)
+	case models.RoundFinished:
+		s.completeAgenda(item)
+	case models.RoundAborted:
+		s.failAgenda(item, item.LastStep, "round aborted")
+	}
+}
+
+// agendaMissed 错过开始时间过久时标记失败
+func (s *Server) agendaMissed(item models.AgendaItem, now int64) bool {
+	if now <= item.StartAtMS+agendaMissGrace.Milliseconds() {
+		return false
+	}
+	s.failAgenda(item, item.LastStep, "missed start time")
+	return true
+}
+
+// finishAgendaStep 记录一步的结果。已有进行中轮次或开奖正由他处进行时不算失败，保留错误并在下一次继续等待
+func (s *Server) finishAgendaStep(item models.AgendaItem, step string, err error) {
+	if err == nil {
+		_, _ = s.DB.Exec(`UPDATE round_agenda SET last_step=?, last_error='', updated_at=NOW() WHERE id=?`, step, item.ID)
+		return
+	}
+	if errors.Is(err, errRoundActive) || errors.Is(err, errDrawInProgress) {
+		if item.LastError != err.Error() {
+			_, _ = s.DB.Exec(`UPDATE round_agenda SET last_error=?, updated_at=NOW() WHERE id=?`, trimAdjustReason(err.Error()), item.ID)
+		}
+		return
+	}
+	s.failAgenda(item, step, err.Error())
+}
+
+func (s *Server) failAgenda(item models.AgendaItem, step, reason string) {
+	log.Printf("agenda round=%d step=%s failed: %s", item.RoundID, step, reason)
+	_, _ = s.DB.Exec(`UPDATE round_agenda SET status=?, last_step=?, last_error=?, updated_at=NOW() WHERE id=?`,
+		agendaFailed, step, trimAdjustReason(reason), item.ID)
+}
+
+func (s *Server) completeAgenda(item models.AgendaItem) {
+	_, _ = s.DB.Exec(`UPDATE round_agenda SET status=?, last_error='', updated_at=NOW() WHERE id=?`, agendaDone, item.ID)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAnnouncementLen = 200
+
+var announcementSeq atomic.Int64
+
+type announceRequest struct {
+	Text       string `json:"text"`
+	DurationMS int    `json:"duration_ms"`
+}
+
+// Announce 管理员公告，推送给所有用户连接与大屏
+func (s *Server) Announce(c *gin.Context) {
+	var req announceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text required"})
+		return
+	}
+	if len([]rune(text)) > maxAnnouncementLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text too long"})
+		return
+	}
+	if req.DurationMS <= 0 {
+		req.DurationMS = 8000
+	}
+	msg := map[string]interface{}{
+		"id":          announcementSeq.Add(1),
+		"text":        text,
+		"duration_ms": req.DurationMS,
+		"server_time": time.Now().UnixMilli(),
+	}
+	payload := mustJSON(WSMessage{Type: "announcement", Data: msg})
+	s.Hub.Broadcast(payload)
+	s.Hub.BroadcastScreens(payload)
+	c.JSON(http.StatusOK, msg)
+}
@@ -94,6 +94,10 @@ type userRow struct {
 	Nickname  string `json:"nickname"`
 	AvatarURL string `json:"avatar_url"`
 	IsAdmin   bool   `json:"is_admin"`
+	// 花名册资料，仅 getUsersByIDs 填充
+	RealName   string `json:"real_name,omitempty"`
+	Department string `json:"department,omitempty"`
+	EmployeeNo string `json:"employee_no,omitempty"`
 }
 
 func (s *Server) getUserByPhone(phone string) (*userRow, error) {
@@ -118,6 +122,53 @@ func (s *Server) getUserByID(uid int64) (*userRow, error) {
 	return &u, nil
 }
 
+// getUsersByIDs 批量加载用户信息，查询失败时返回空 map
+func (s *Server) getUsersByIDs(ids []int64) map[int64]userRow {
+	users := make(map[int64]userRow, len(ids))
+	if len(ids) == 0 {
+		return users
+	}
+	query := `SELECT u.id, u.phone, u.nickname, u.avatar_url, u.is_admin, COALESCE(e.name, ''), COALESCE(NULLIF(e.department, ''), u.department), COALESCE(e.employee_no, '')
+		FROM users u LEFT JOIN roster_employees e ON e.user_id = u.id WHERE u.id IN (` + strings.TrimRight(strings.Repeat("?,", len(ids)), ",") + `)`
+	args := make([]interface{}, len(ids))
+	for i, v := range ids {
+		args[i] = v
+	}
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return users
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u userRow
+		var isAdmin int
+		if err := rows.Scan(&u.ID, &u.Phone, &u.Nickname, &u.AvatarURL, &isAdmin, &u.RealName, &u.Department, &u.EmployeeNo); err == nil {
+			u.IsAdmin = isAdmin == 1
+			users[u.ID] = u
+		}
+	}
+	return users
+}
+
+// maskPhone 隐藏手机号中间四位，用于对外展示
+func maskPhone(phone string) string {
+	if len(phone) < 7 {
+		return phone
+	}
+	return phone[:3] + "****" + phone[len(phone)-4:]
+}
+
+// publicName 对外展示名：优先花名册姓名，其次昵称，否则脱敏手机号
+func publicName(u userRow) string {
+	if u.RealName != "" {
+		return u.RealName
+	}
+	if u.Nickname != "" {
+		return u.Nickname
+	}
+	return maskPhone(u.Phone)
+}
+
 func boolToInt(v bool) int {
 	if v {
 		return 1
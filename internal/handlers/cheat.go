@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/models"
+)
+
+// 作弊检测阈值
+const (
+	cheatMinClicks          = 20   // 点击数不足时不评估统计类信号
+	cheatFastReactionMS     = 150  // 低于该反应时间视为超人类反应
+	cheatFastRatio          = 0.3  // 超快反应占比阈值
+	cheatPreVisibleSlackMS  = 100  // 早于红包出现超过该值视为“未出现即点击”
+	cheatPreVisibleMaxCount = 2    // 允许的少量时钟误差
+	cheatRegularCV          = 0.2  // 点击间隔变异系数低于该值视为机械节奏
+	cheatCoverageRatio      = 0.9  // 点中非炸弹红包的覆盖率阈值
+	cheatMinExpectedBombs   = 5.0  // 期望炸弹命中数达到该值且一次未中视为刻意规避
+	clickStreamPageSize     = 5000 // XRANGE 分页大小
+)
+
+type clickRecord struct {
+	effMS   int64
+	startMS int64
+	bomb    bool
+}
+
+type clickSignals struct {
+	UserID           int64    `json:"user_id"`
+	Phone            string   `json:"phone"`
+	Nickname         string   `json:"nickname"`
+	Score            int      `json:"score"`
+	Clicks           int      `json:"clicks"`
+	ReactionP10MS    int64    `json:"reaction_p10_ms"`
+	ReactionMedianMS int64    `json:"reaction_median_ms"`
+	FastRatio        float64  `json:"fast_ratio"`
+	PreVisibleClicks int      `json:"pre_visible_clicks"`
+	BombClicks       int      `json:"bomb_clicks"`
+	ExpectedBombs    float64  `json:"expected_bombs"`
+	IntervalCV       float64  `json:"interval_cv"`
+	Coverage         float64  `json:"coverage"`
+	Reasons          []string `json:"reasons"`
+	Flagged          bool     `json:"flagged"`
+	Excluded         bool     `json:"excluded"`
+	ExcludeReason    string   `json:"exclude_reason,omitempty"`
+}
+
+// loadClickRecords 分页读取轮次点击流，按用户分组
+func (s *Server) loadClickRecords(ctx context.Context, roundID int64) (map[int64][]clickRecord, error) {
+	out := make(map[int64][]clickRecord)
+	start := "-"
+	for {
+		msgs, err := s.Redis.XRangeN(ctx, clickStreamKey(roundID), start, "+", clickStreamPageSize).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			uid := streamInt(m.Values["uid"])
+			if uid <= 0 {
+				continue
+			}
+			eff := streamInt(m.Values["eff"])
+			if eff == 0 {
+				eff = streamInt(m.Values["ts"])
+			}
+			out[uid] = append(out[uid], clickRecord{
+				effMS:   eff,
+				startMS: streamInt(m.Values["start"]),
+				bomb:    streamInt(m.Values["bomb"]) == 1,
+			})
+		}
+		if len(msgs) < clickStreamPageSize {
+			return out, nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+func streamInt(v interface{}) int64 {
+	switch val := v.(type) {
+	case string:
+		n, _ := strconv.ParseInt(val, 10, 64)
+		return n
+	case int64:
+		return val
+	}
+	return 0
+}
+
+// analyzeClicks 计算单个用户的作弊信号
+func analyzeClicks(round models.Round, records []clickRecord) clickSignals {
+	sig := clickSignals{Clicks: len(records), Reasons: []string{}}
+	if len(records) == 0 {
+		return sig
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].effMS < records[j].effMS })
+
+	reactions := make([]int64, 0, len(records))
+	fast := 0
+	for _, r := range records {
+		if r.bomb {
+			sig.BombClicks++
+		}
+		if r.startMS <= 0 {
+			continue
+		}
+		reaction := r.effMS - r.startMS
+		if reaction < -cheatPreVisibleSlackMS {
+			sig.PreVisibleClicks++
+		}
+		if reaction < cheatFastReactionMS {
+			fast++
+		}
+		reactions = append(reactions, reaction)
+	}
+	if len(reactions) > 0 {
+		sort.Slice(reactions, func(i, j int) bool { return reactions[i] < reactions[j] })
+		sig.ReactionP10MS = reactions[len(reactions)/10]
+		sig.ReactionMedianMS = reactions[len(reactions)/2]
+		sig.FastRatio = float64(fast) / float64(len(reactions))
+	}
+
+	if round.DropsPerSlice > 0 {
+		sig.ExpectedBombs = float64(len(records)) * float64(round.BombsPerSlice) / float64(round.DropsPerSlice)
+	}
+
+	intervals := make([]float64, 0, len(records))
+	for i := 1; i < len(records); i++ {
+		if d := records[i].effMS - records[i-1].effMS; d > 0 {
+			intervals = append(intervals, float64(d))
+		}
+	}
+	if len(intervals) > 1 {
+		var sum float64
+		for _, d := range intervals {
+			sum += d
+		}
+		mean := sum / float64(len(intervals))
+		var variance float64
+		for _, d := range intervals {
+			variance += (d - mean) * (d - mean)
+		}
+		variance /= float64(len(intervals))
+		if mean > 0 {
+			sig.IntervalCV = math.Sqrt(variance) / mean
+		}
+	}
+
+	if round.SliceMS > 0 {
+		sliceCount := round.DurationSec * 1000 / round.SliceMS
+		if round.DurationSec*1000%round.SliceMS != 0 {
+			sliceCount++
+		}
+		if clickable := sliceCount * (round.DropsPerSlice - round.BombsPerSlice); clickable > 0 {
+			sig.Coverage = float64(len(records)-sig.BombClicks) / float64(clickable)
+		}
+	}
+
+	strong := 0
+	if sig.PreVisibleClicks > cheatPreVisibleMaxCount {
+		sig.Reasons = append(sig.Reasons, "pre_visible_clicks")
+		strong++
+	}
+	if sig.Clicks >= cheatMinClicks {
+		if sig.FastRatio >= cheatFastRatio {
+			sig.Reasons = append(sig.Reasons, "fast_reaction")
+			strong++
+		}
+		if len(intervals) >= cheatMinClicks && sig.IntervalCV < cheatRegularCV {
+			sig.Reasons = append(sig.Reasons, "regular_interval")
+			strong++
+		}
+		if sig.Coverage >= cheatCoverageRatio {
+			sig.Reasons = append(sig.Reasons, "high_coverage")
+			strong++
+		}
+	}
+	// 规避炸弹对人类也常见，单独出现不判定
+	if sig.ExpectedBombs >= cheatMinExpectedBombs && sig.BombClicks == 0 {
+		sig.Reasons = append(sig.Reasons, "bomb_avoidance")
+	}
+	sig.Flagged = strong > 0 || len(sig.Reasons) >= 2
+	return sig
+}
+
+// GetRoundSuspects 基于点击流的作弊嫌疑列表，默认只返回被标记的用户，?all=1 返回全部
+func (s *Server) GetRoundSuspects(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	ctx := context.Background()
+	records, err := s.loadClickRecords(ctx, roundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	excluded, _ := s.roundExclusions(roundID)
+	showAll := parseBool(c.Query("all"), false)
+
+	items := make([]clickSignals, 0)
+	for uid, recs := range records {
+		sig := analyzeClicks(*round, recs)
+		sig.UserID = uid
+		if reason, ok := excluded[uid]; ok {
+			sig.Excluded = true
+			sig.ExcludeReason = reason
+		}
+		if !showAll && !sig.Flagged && !sig.Excluded {
+			continue
+		}
+		items = append(items, sig)
+	}
+	ids := make([]int64, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.UserID)
+	}
+	infoMap := s.getUsersByIDs(ids)
+	scoreMap := make(map[int64]float64, len(items))
+	if len(ids) > 0 {
+		members := make([]string, len(ids))
+		for i, uid := range ids {
+			members[i] = scoreMember(uid)
+		}
+		if scores, err := s.Redis.ZMScore(ctx, scoreZSetKey(roundID), members...).Result(); err == nil {
+			for i, uid := range ids {
+				scoreMap[uid] = scores[i]
+			}
+		}
+	}
+	for i := range items {
+		info := infoMap[items[i].UserID]
+		items[i].Phone = info.Phone
+		items[i].Nickname = info.Nickname
+		items[i].Score = int(scoreMap[items[i].UserID])
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Flagged != items[j].Flagged {
+			return items[i].Flagged
+		}
+		return len(items[i].Reasons) > len(items[j].Reasons)
+	})
+	c.JSON(http.StatusOK, gin.H{"round_id": roundID, "status": round.Status, "items": items})
+}
+
+type exclusionRequest struct {
+	UserIDs []int64 `json:"user_ids"`
+	Reason  string  `json:"reason"`
+}
+
+// roundDrawn 已开奖（或正在开奖）的轮次不允许再修改排除名单
+func roundDrawn(status models.RoundStatus) bool {
+	return status == models.RoundDrawing || status == models.RoundPendingConfirm || status == models.RoundFinished
+}
+
+// ExcludeRoundUsers 将用户排除出开奖（需在开奖前操作）
+func (s *Server) ExcludeRoundUsers(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req exclusionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.UserIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if roundDrawn(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round already drawn"})
+		return
+	}
+	reason := trimAdjustReason(req.Reason)
+	operator := adminOperator(c)
+	for _, uid := range req.UserIDs {
+		if uid <= 0 {
+			continue
+		}
+		if _, err := s.DB.Exec(`INSERT INTO round_exclusions (round_id, user_id, reason, created_at) VALUES (?, ?, ?, NOW())
+			ON DUPLICATE KEY UPDATE reason=VALUES(reason)`, roundID, uid, reason); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+		if err := s.recordRoundAdjustment(roundID, uid, adjustKindExclude, 0, reason, operator); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(req.UserIDs)})
+}
+
+// RemoveRoundExclusion 取消排除
+func (s *Server) RemoveRoundExclusion(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	uid, err := parseIDParam(c, "uid")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if roundDrawn(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round already drawn"})
+		return
+	}
+	res, err := s.DB.Exec(`DELETE FROM round_exclusions WHERE round_id=? AND user_id=?`, roundID, uid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err := s.recordRoundAdjustment(roundID, uid, adjustKindInclude, 0, "", adminOperator(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// roundExclusions 轮次排除名单（user_id -> reason）
+func (s *Server) roundExclusions(roundID int64) (map[int64]string, error) {
+	out := make(map[int64]string)
+	rows, err := s.DB.Query(`SELECT user_id, reason FROM round_exclusions WHERE round_id=?`, roundID)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid int64
+		var reason string
+		if err := rows.Scan(&uid, &reason); err == nil {
+			out[uid] = reason
+		}
+	}
+	return out, rows.Err()
+}
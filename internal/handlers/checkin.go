@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/models"
+)
+
+const (
+	// 同一时间只有一个签到会话，随大屏展示
+	checkinSessionKey = "checkin:session"
+	// 二维码令牌的轮换周期
+	checkinWindowMS = 30000
+	// 令牌轮换后上一枚仍可使用的宽限，覆盖扫码到提交的耗时
+	checkinGraceMS = 5000
+	// 会话最长保留时间，管理员忘记关闭时兜底
+	checkinSessionTTL = 12 * time.Hour
+)
+
+var (
+	errCheckinClosed  = errors.New("checkin closed")
+	errCheckinToken   = errors.New("invalid token")
+	errCheckinExpired = errors.New("token expired")
+	errCheckinRound   = errors.New("round not open for checkin")
+)
+
+type checkinRequest struct {
+	Token string `json:"token"`
+}
+
+type checkinSession struct {
+	RoundID  int64
+	Secret   string
+	Operator string
+	OpenedAt int64
+}
+
+// checkinOpen 只有未开始的轮次可以签到入场
+func checkinOpen(status models.RoundStatus) bool {
+	return status == models.RoundWaiting || status == models.RoundLocked
+}
+
+func (s *Server) loadCheckinSession(ctx context.Context) (*checkinSession, error) {
+	if s.Redis == nil {
+		return nil, nil
+	}
+	vals, err := s.Redis.HGetAll(ctx, checkinSessionKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	roundID, _ := strconv.ParseInt(vals["round_id"], 10, 64)
+	if roundID <= 0 || vals["secret"] == "" {
+		return nil, nil
+	}
+	openedAt, _ := strconv.ParseInt(vals["opened_at"], 10, 64)
+	return &checkinSession{RoundID: roundID, Secret: vals["secret"], Operator: vals["operator"], OpenedAt: openedAt}, nil
+}
+
+// checkinToken 令牌格式 round_id.window.sig，sig 由会话密钥签名，关闭或重开会话后旧令牌全部失效
+func checkinToken(sess *checkinSession, window int64) string {
+	return fmt.Sprintf("%d.%d.%s", sess.RoundID, window, checkinSign(sess, window))
+}
+
+func checkinSign(sess *checkinSession, window int64) string {
+	h := hmac.New(sha256.New, []byte(sess.Secret))
+	_, _ = h.Write([]byte(fmt.Sprintf("checkin|%d|%d", sess.RoundID, window)))
+	return hex.EncodeToString(h.Sum(nil))[:24]
+}
+
+// verifyCheckinToken 只接受当前周期的令牌，以及刚轮换时宽限期内的上一枚
+func verifyCheckinToken(sess *checkinSession, token string, nowMS int64) error {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return errCheckinToken
+	}
+	roundID, err1 := strconv.ParseInt(parts[0], 10, 64)
+	window, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || roundID != sess.RoundID {
+		return errCheckinToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(checkinSign(sess, window))) {
+		return errCheckinToken
+	}
+	current := nowMS / checkinWindowMS
+	if window == current || (window == current-1 && nowMS-current*checkinWindowMS < checkinGraceMS) {
+		return nil
+	}
+	return errCheckinExpired
+}
+
+// checkinPayload 大屏展示的二维码内容，没有进行中的签到时返回 nil
+func (s *Server) checkinPayload(ctx context.Context, nowMS int64) map[string]interface{} {
+	sess, err := s.loadCheckinSession(ctx)
+	if err != nil || sess == nil {
+		return nil
+	}
+	window := nowMS / checkinWindowMS
+	token := checkinToken(sess, window)
+	return map[string]interface{}{
+		"round_id":   sess.RoundID,
+		"token":      token,
+		"path":       "/?checkin=" + token,
+		"expires_at": (window + 1) * checkinWindowMS,
+	}
+}
+
+// closeCheckinSession 关闭指定轮次的签到会话，roundID 为 0 时无条件关闭
+func (s *Server) closeCheckinSession(ctx context.Context, roundID int64) bool {
+	sess, err := s.loadCheckinSession(ctx)
+	if err != nil || sess == nil || (roundID > 0 && sess.RoundID != roundID) {
+		return false
+	}
+	_ = s.Redis.Del(ctx, checkinSessionKey).Err()
+	return true
+}
+
+func (s *Server) countCheckins(roundID int64) int {
+	var count int
+	_ = s.DB.QueryRow(`SELECT COUNT(1) FROM round_checkins WHERE round_id = ?`, roundID).Scan(&count)
+	return count
+}
+
+// OpenCheckin 为未开始的轮次开启签到，替换已有的签到会话
+func (s *Server) OpenCheckin(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if s.Redis == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "redis unavailable"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if !checkinOpen(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCheckinRound.Error()})
+		return
+	}
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	pipe := s.Redis.TxPipeline()
+	pipe.Del(ctx, checkinSessionKey)
+	pipe.HSet(ctx, checkinSessionKey, map[string]interface{}{
+		"round_id":  roundID,
+		"secret":    newSessionID(),
+		"operator":  adminOperator(c),
+		"opened_at": now,
+	})
+	pipe.Expire(ctx, checkinSessionKey, checkinSessionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	s.pushScreenState()
+	c.JSON(http.StatusOK, gin.H{"status": "open", "round_id": roundID, "checkin": s.checkinPayload(ctx, now)})
+}
+
+// CloseCheckin 关闭轮次的签到会话
+func (s *Server) CloseCheckin(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if s.Redis == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "redis unavailable"})
+		return
+	}
+	if !s.closeCheckinSession(context.Background(), roundID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "checkin not open"})
+		return
+	}
+	s.pushScreenState()
+	c.JSON(http.StatusOK, gin.H{"status": "closed", "count": s.countCheckins(roundID)})
+}
+
+// GetCheckin 签到状态与已签到人数，进行中时附带当前令牌
+func (s *Server) GetCheckin(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := context.Background()
+	resp := gin.H{"round_id": roundID, "open": false, "count": s.countCheckins(roundID)}
+	if sess, err := s.loadCheckinSession(ctx); err == nil && sess != nil && sess.RoundID == roundID {
+		resp["open"] = true
+		resp["operator"] = sess.Operator
+		resp["opened_at"] = sess.OpenedAt
+		resp["checkin"] = s.checkinPayload(ctx, time.Now().UnixMilli())
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Checkin 用户扫描大屏二维码签到，加入轮次白名单
+func (s *Server) Checkin(c *gin.Context) {
+	var req checkinRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Token) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	uid := c.GetInt64("uid")
+	ctx := context.Background()
+	sess, err := s.loadCheckinSession(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	if sess == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCheckinClosed.Error()})
+		return
+	}
+	now := time.Now().UnixMilli()
+	if err := verifyCheckinToken(sess, req.Token, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	round, err := s.getRoundByID(sess.RoundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if !checkinOpen(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCheckinRound.Error()})
+		return
+	}
+
+	res, err := s.DB.Exec(`INSERT IGNORE INTO round_checkins (round_id, user_id, ip, created_at) VALUES (?, ?, ?, NOW())`,
+		round.ID, uid, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	first, _ := res.RowsAffected()
+	if _, err := s.addRoundWhitelist(round, []int64{uid}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	// 已锁定的轮次立即切换到可参与状态
+	if round.Status == models.RoundLocked && s.Redis != nil {
+		eligible := true
+		whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
+		s.Hub.SendToUser(uid, mustJSON(WSMessage{
+			Type: "round_state",
+			Data: s.roundStatePayload(*round, nil, &eligible, s.onlineCount(ctx, round.ID), int(whitelistCount), uid),
+		}))
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "round_id": round.ID, "first": first > 0})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+)
+
+const (
+	clockSampleWindow = 32
+	rttSampleWindow   = 8
+)
+
+// clockEstimator 按连接估计客户端时钟偏移与 RTT。
+// 样本为 服务端收到时间 - 客户端时间戳（= 单程延迟 - 时钟偏移），取滑动窗口内最小值作为基线，
+// 基线之上的部分即为该条消息的排队/网络抖动。
+// RTT 由服务端计时：发出 WebSocket ping 到收到回显同一 payload 的 pong，客户端只能拖慢不能伪造更小值，取窗口内最小值。
+type clockEstimator struct {
+	mu      sync.Mutex
+	samples [clockSampleWindow]int64
+	count   int
+	next    int
+
+	pingSeq    int64
+	pingSentMS int64
+	rttSamples [rttSampleWindow]int64
+	rttCount   int
+	rttNext    int
+}
+
+func (e *clockEstimator) observe(clientTS int64, serverNowMS int64) {
+	if clientTS <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.samples[e.next] = serverNowMS - clientTS
+	e.next = (e.next + 1) % clockSampleWindow
+	if e.count < clockSampleWindow {
+		e.count++
+	}
+}
+
+// nextPing 生成下一次服务端 ping 的 payload 并记录发出时间，同一时间只认最近一次 ping
+func (e *clockEstimator) nextPing(nowMS int64) []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pingSeq++
+	e.pingSentMS = nowMS
+	return []byte(strconv.FormatInt(e.pingSeq, 10))
+}
+
+// observePong 收到 pong 时计算 RTT，payload 与最近一次 ping 不符或重复回显的忽略，超过上限的按上限计
+func (e *clockEstimator) observePong(payload string, nowMS int64, maxRTTMS int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pingSentMS == 0 || payload != strconv.FormatInt(e.pingSeq, 10) {
+		return
+	}
+	rttMS := min(max(nowMS-e.pingSentMS, 0), maxRTTMS)
+	e.pingSentMS = 0
+	e.rttSamples[e.rttNext] = rttMS
+	e.rttNext = (e.rttNext + 1) % rttSampleWindow
+	if e.rttCount < rttSampleWindow {
+		e.rttCount++
+	}
+}
+
+func (e *clockEstimator) baseline() (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.count == 0 {
+		return 0, false
+	}
+	base := e.samples[0]
+	for i := 1; i < e.count; i++ {
+		if e.samples[i] < base {
+			base = e.samples[i]
+		}
+	}
+	return base, true
+}
+
+func (e *clockEstimator) rtt() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rttCount == 0 {
+		return 0
+	}
+	best := e.rttSamples[0]
+	for i := 1; i < e.rttCount; i++ {
+		best = min(best, e.rttSamples[i])
+	}
+	return best
+}
+
+// clickTime 把客户端点击时间换算到服务端时钟。
+// 超出基线的延迟在 容差 + RTT/2 以内时回溯到点击发生时刻，否则按服务端收到时间处理；
+// 早于基线（声称的时间比物理上可能的更晚）同样按收到时间处理，因此单条点击最多只能被挪动容差范围。
+func (s *Server) clickTime(clock *clockEstimator, clientTS int64, nowMS int64) int64 {
+	if clock == nil || clientTS <= 0 {
+		return nowMS
+	}
+	base, ok := clock.baseline()
+	clock.observe(clientTS, nowMS)
+	if !ok {
+		return nowMS
+	}
+	excess := (nowMS - clientTS) - base
+	if excess <= 0 {
+		return nowMS
+	}
+	tolerance := int64(s.Cfg.ClickTimeToleranceMS) + clock.rtt()/2
+	if excess > tolerance {
+		return nowMS
+	}
+	return nowMS - excess
+}
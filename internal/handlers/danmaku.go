@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	danmakuSwitchKey    = "cfg:danmaku_enabled"
+	danmakuBlocklistKey = "cfg:danmaku_blocklist"
+	// 屏蔽词已由管理员设置过的标记，区分“清空”与“未设置”
+	danmakuBlocklistSetKey = "cfg:danmaku_blocklist_set"
+	danmakuMutedKey        = "danmaku:muted"
+	danmakuRecentLimit     = 200
+)
+
+var (
+	errDanmakuDisabled = errors.New("danmaku disabled")
+	errDanmakuEmpty    = errors.New("empty message")
+	errDanmakuTooLong  = errors.New("message too long")
+	errDanmakuMuted    = errors.New("muted")
+	errDanmakuTooFast  = errors.New("too frequent")
+	errDanmakuBlocked  = errors.New("message blocked")
+)
+
+type danmakuMessage struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Text   string `json:"text"`
+	TS     int64  `json:"ts"`
+}
+
+// danmakuBoard 保存弹幕限流状态、屏蔽词与最近消息（供管理员查看/删除）
+type danmakuBoard struct {
+	mu        sync.Mutex
+	seq       int64
+	recent    []danmakuMessage
+	lastSent  map[int64]int64
+	lastPrune int64
+	blocklist []string
+}
+
+func (b *danmakuBoard) allow(uid int64, nowMS int64, intervalMS int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.lastSent == nil {
+		b.lastSent = make(map[int64]int64)
+	}
+	// 定期清掉已过限流窗口的记录，避免随发言人数无限增长
+	if nowMS-b.lastPrune >= max(intervalMS, 1000) {
+		for id, last := range b.lastSent {
+			if nowMS-last >= intervalMS {
+				delete(b.lastSent, id)
+			}
+		}
+		b.lastPrune = nowMS
+	}
+	if last, ok := b.lastSent[uid]; ok && nowMS-last < intervalMS {
+		return false
+	}
+	b.lastSent[uid] = nowMS
+	return true
+}
+
+func (b *danmakuBoard) add(msg danmakuMessage) danmakuMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	msg.ID = b.seq
+	b.recent = append(b.recent, msg)
+	if len(b.recent) > danmakuRecentLimit {
+		b.recent = append(b.recent[:0], b.recent[len(b.recent)-danmakuRecentLimit:]...)
+	}
+	return msg
+}
+
+func (b *danmakuBoard) remove(id int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, msg := range b.recent {
+		if msg.ID == id {
+			b.recent = append(b.recent[:i], b.recent[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *danmakuBoard) snapshot() []danmakuMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]danmakuMessage, len(b.recent))
+	copy(out, b.recent)
+	return out
+}
+
+func (b *danmakuBoard) setBlocklist(words []string) {
+	cleaned := make([]string, 0, len(words))
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w != "" {
+			cleaned = append(cleaned, w)
+		}
+	}
+	b.mu.Lock()
+	b.blocklist = cleaned
+	b.mu.Unlock()
+}
+
+func (b *danmakuBoard) blockedWords() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]string, len(b.blocklist))
+	copy(out, b.blocklist)
+	return out
+}
+
+func (b *danmakuBoard) isBlocked(text string) bool {
+	lower := strings.ToLower(text)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, w := range b.blocklist {
+		if strings.Contains(lower, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) loadDanmakuSettings() {
+	s.danmakuEnabled.Store(s.Cfg.DanmakuEnabled)
+	s.danmaku.setBlocklist(s.Cfg.DanmakuBlocklist)
+	if s.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	if val, err := s.Redis.Get(ctx, danmakuSwitchKey).Result(); err == nil {
+		s.danmakuEnabled.Store(parseBool(val, s.danmakuEnabled.Load()))
+	}
+	words, err := s.Redis.SMembers(ctx, danmakuBlocklistKey).Result()
+	if err != nil {
+		return
+	}
+	// 管理员清空过的列表为空集合，仍以 Redis 为准；没有标记的旧数据只认非空列表
+	if configured, _ := s.Redis.Exists(ctx, danmakuBlocklistSetKey).Result(); configured > 0 || len(words) > 0 {
+		s.danmaku.setBlocklist(words)
+	}
+}
+
+func (s *Server) IsDanmakuEnabled() bool {
+	return s.danmakuEnabled.Load()
+}
+
+func (s *Server) setDanmakuEnabled(enabled bool) {
+	s.danmakuEnabled.Store(enabled)
+	if s.Redis != nil {
+		val := "0"
+		if enabled {
+			val = "1"
+		}
+		_ = s.Redis.Set(context.Background(), danmakuSwitchKey, val, 0).Err()
+	}
+	payload := mustJSON(WSMessage{Type: "danmaku_config", Data: map[string]interface{}{"enabled": enabled}})
+	s.Hub.Broadcast(payload)
+	s.Hub.BroadcastScreens(payload)
+}
+
+func (s *Server) setDanmakuBlocklist(words []string) {
+	s.danmaku.setBlocklist(words)
+	if s.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cleaned := s.danmaku.blockedWords()
+	pipe := s.Redis.TxPipeline()
+	pipe.Del(ctx, danmakuBlocklistKey)
+	if len(cleaned) > 0 {
+		members := make([]interface{}, len(cleaned))
+		for i, w := range cleaned {
+			members[i] = w
+		}
+		pipe.SAdd(ctx, danmakuBlocklistKey, members...)
+	}
+	pipe.Set(ctx, danmakuBlocklistSetKey, "1", 0)
+	_, _ = pipe.Exec(ctx)
+}
+
+func (s *Server) isDanmakuMuted(ctx context.Context, uid int64, nowMS int64) bool {
+	if s.Redis == nil {
+		return false
+	}
+	val, err := s.Redis.HGet(ctx, danmakuMutedKey, strconv.FormatInt(uid, 10)).Result()
+	if err != nil {
+		return false
+	}
+	until, _ := strconv.ParseInt(val, 10, 64)
+	if until == 0 || until > nowMS {
+		return true
+	}
+	_ = s.Redis.HDel(ctx, danmakuMutedKey, strconv.FormatInt(uid, 10)).Err()
+	return false
+}
+
+// sendDanmaku 校验并广播一条弹幕：需开启弹幕、当前轮次白名单、未禁言、未超频、未命中屏蔽词
+func (s *Server) sendDanmaku(ctx context.Context, uid int64, text string) (danmakuMessage, error) {
+	if !s.IsDanmakuEnabled() {
+		return danmakuMessage{}, errDanmakuDisabled
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return danmakuMessage{}, errDanmakuEmpty
+	}
+	if len([]rune(text)) > s.Cfg.DanmakuMaxLen {
+		return danmakuMessage{}, errDanmakuTooLong
+	}
+	rt := s.Game.GetCurrent()
+	if rt == nil || !s.isWhitelisted(rt.Round.ID, uid) {
+		return danmakuMessage{}, errors.New("not whitelisted")
+	}
+	now := time.Now().UnixMilli()
+	if s.isDanmakuMuted(ctx, uid, now) {
+		return danmakuMessage{}, errDanmakuMuted
+	}
+	if !s.danmaku.allow(uid, now, int64(s.Cfg.DanmakuIntervalMS)) {
+		return danmakuMessage{}, errDanmakuTooFast
+	}
+	if s.danmaku.isBlocked(text) {
+		return danmakuMessage{}, errDanmakuBlocked
+	}
+	name := ""
+	if user, err := s.getUserByID(uid); err == nil {
+		name = publicName(*user)
+	}
+	msg := s.danmaku.add(danmakuMessage{UserID: uid, Name: name, Text: text, TS: now})
+	payload := mustJSON(WSMessage{Type: "danmaku", Data: msg})
+	s.Hub.Broadcast(payload)
+	s.Hub.BroadcastScreens(payload)
+	return msg, nil
+}
+
+func (s *Server) GetDanmakuAdmin(c *gin.Context) {
+	muted := make([]gin.H, 0)
+	if s.Redis != nil {
+		if vals, err := s.Redis.HGetAll(context.Background(), danmakuMutedKey).Result(); err == nil {
+			for uidStr, untilStr := range vals {
+				uid, _ := strconv.ParseInt(uidStr, 10, 64)
+				until, _ := strconv.ParseInt(untilStr, 10, 64)
+				muted = append(muted, gin.H{"user_id": uid, "until": until})
+			}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   s.IsDanmakuEnabled(),
+		"blocklist": s.danmaku.blockedWords(),
+		"muted":     muted,
+		"recent":    s.danmaku.snapshot(),
+	})
+}
+
+func (s *Server) UpdateDanmakuAdmin(c *gin.Context) {
+	var req struct {
+		Enabled   *bool     `json:"enabled"`
+		Blocklist *[]string `json:"blocklist"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Enabled == nil && req.Blocklist == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if req.Blocklist != nil {
+		s.setDanmakuBlocklist(*req.Blocklist)
+	}
+	if req.Enabled != nil {
+		s.setDanmakuEnabled(*req.Enabled)
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": s.IsDanmakuEnabled(), "blocklist": s.danmaku.blockedWords()})
+}
+
+func (s *Server) MuteDanmakuUser(c *gin.Context) {
+	var req struct {
+		UserID  int64 `json:"user_id"`
+		Muted   *bool `json:"muted"`
+		Minutes int   `json:"minutes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if s.Redis == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis not configured"})
+		return
+	}
+	ctx := context.Background()
+	field := strconv.FormatInt(req.UserID, 10)
+	if req.Muted != nil && !*req.Muted {
+		if err := s.Redis.HDel(ctx, danmakuMutedKey, field).Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": req.UserID, "muted": false})
+		return
+	}
+	// minutes <= 0 表示永久禁言
+	until := int64(0)
+	if req.Minutes > 0 {
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute).UnixMilli()
+	}
+	if err := s.Redis.HSet(ctx, danmakuMutedKey, field, until).Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redis error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": req.UserID, "muted": true, "until": until})
+}
+
+func (s *Server) DeleteDanmaku(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	s.danmaku.remove(id)
+	// 客户端可能已渲染，无论是否仍在缓存中都广播撤回
+	payload := mustJSON(WSMessage{Type: "danmaku_delete", Data: map[string]interface{}{"id": id}})
+	s.Hub.Broadcast(payload)
+	s.Hub.BroadcastScreens(payload)
+	c.JSON(http.StatusOK, gin.H{"status": "deleted", "id": id})
+}
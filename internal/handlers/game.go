@@ -24,6 +24,7 @@ type clickRequest struct {
 	RoundID  int64  `json:"round_id"`
 	DropID   int    `json:"drop_id"`
 	ClientTS int64  `json:"client_ts"`
+	Nonce    int64  `json:"nonce"`
 	Sign     string `json:"sign"`
 }
 
@@ -68,12 +69,11 @@ func (s *Server) GetGameState(c *gin.Context) {
 	s.MarkOnline(uid)
 	score, _ := s.Redis.ZScore(context.Background(), scoreZSetKey(rt.Round.ID), scoreMember(uid)).Result()
 	eligible := s.isWhitelisted(rt.Round.ID, uid)
+	denied := eligible && s.lateJoinDenied(context.Background(), rt.Round, uid, time.Now().UnixMilli())
+	eligible = eligible && !denied
 	whitelistCount, _ := s.Redis.SCard(context.Background(), whitelistKey(rt.Round.ID)).Result()
-	onlineCount := len(s.getActiveOnlineUserIDs(context.Background()))
+	onlineCount := s.onlineCount(context.Background(), rt.Round.ID)
 	payloadRound := rt.Round
-	if !eligible && payloadRound.Status != models.RoundWaiting && payloadRound.Status != models.RoundLocked {
-		payloadRound.Status = models.RoundLocked
-	}
 	payload := gin.H{
 		"round":           payloadRound,
 		"score":           int(score),
@@ -82,15 +82,21 @@ func (s *Server) GetGameState(c *gin.Context) {
 		"whitelist_count": int(whitelistCount),
 		"server_time":     time.Now().UnixMilli(),
 	}
-	if key, ok := s.gameSignKey(c.GetString("sid")); ok {
-		payload["sign_key"] = hex.EncodeToString(key)
+	if signRoundID, key := s.currentSignKey(c.GetString("sid")); key != "" {
+		payload["sign_key"] = key
+		payload["sign_round_id"] = signRoundID
 	}
 	if withSlices && eligible && (payloadRound.Status == models.RoundRunning || payloadRound.Status == models.RoundCountdown || payloadRound.Status == models.RoundLocked) {
-		manifests := make([]slicePayload, 0, len(rt.Slices))
-		for _, s := range rt.Slices {
-			manifests = append(manifests, buildSlicePayload(s.Manifest, rt.RevealSalt, uid))
+		payload["slices"] = s.userSlicePayloads(rt, uid)
+	}
+	if denied {
+		payload["late_join_denied"] = true
+	}
+	if !eligible {
+		payload["spectator"] = true
+		if withSlices && roundInPlay(payloadRound.Status) {
+			payload["spectator_slices"] = s.spectatorSlices(rt)
 		}
-		payload["slices"] = manifests
 	}
 	c.JSON(http.StatusOK, payload)
 }
@@ -103,12 +109,20 @@ func (s *Server) Click(c *gin.Context) {
 	}
 	uid := c.GetInt64("uid")
 	sid := c.GetString("sid")
-	if !s.verifySign(uid, sid, req.RoundID, req.DropID, req.ClientTS, req.Sign) {
+	if err := s.allowClick(context.Background(), uid, c.ClientIP()); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.verifySign(uid, sid, req.RoundID, req.DropID, req.ClientTS, req.Nonce, req.Sign) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid sign"})
 		return
 	}
+	if err := s.consumeClickNonce(context.Background(), sid, req.RoundID, req.Nonce); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 
-	delta, total, isBomb, err := s.processClick(context.Background(), uid, req.RoundID, req.DropID, req.ClientTS)
+	delta, total, isBomb, err := s.processClick(context.Background(), uid, req.RoundID, req.DropID, req.ClientTS, nil, nil)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -172,16 +186,20 @@ func (s *Server) GetGameReveal(c *gin.Context) {
 	})
 }
 
-func (s *Server) verifySign(uid int64, sessionID string, roundID int64, dropID int, clientTS int64, sign string) bool {
+func (s *Server) verifySign(uid int64, sessionID string, roundID int64, dropID int, clientTS int64, nonce int64, sign string) bool {
 	sign = strings.TrimSpace(sign)
 	if sign == "" {
 		return false
 	}
-	key, ok := s.gameSignKey(sessionID)
+	rt := s.Game.GetCurrent()
+	if rt == nil || rt.Round.ID != roundID {
+		return false
+	}
+	key, ok := s.gameSignKey(sessionID, roundID, rt.Round.Seed)
 	if !ok {
 		return false
 	}
-	msg := fmt.Sprintf("%d|%d|%d|%d", uid, roundID, dropID, clientTS)
+	msg := fmt.Sprintf("%d|%d|%d|%d|%d", uid, roundID, dropID, clientTS, nonce)
 	h := hmac.New(sha256.New, key)
 	_, _ = h.Write([]byte(msg))
 	expected := hex.EncodeToString(h.Sum(nil))
@@ -192,31 +210,28 @@ func clickStreamKey(roundID int64) string {
 	return "round:" + strconv.FormatInt(roundID, 10) + ":clicks"
 }
 
-func (s *Server) processClick(ctx context.Context, uid int64, roundID int64, dropID int, clientTS int64) (int, int, bool, error) {
+// processClick 校验并计分。clock 与 joins 为 WS 连接的时钟估计与加入时间缓存，HTTP 点击传 nil，按服务端收到时间判定
+func (s *Server) processClick(ctx context.Context, uid int64, roundID int64, dropID int, clientTS int64, clock *clockEstimator, joins *lateJoinCache) (int, int, bool, error) {
 	// 白名单校验
 	if !s.isWhitelisted(roundID, uid) {
 		return 0, 0, false, errors.New("not whitelisted")
 	}
 
 	now := time.Now().UnixMilli()
-	effectiveNow := now
-	if clientTS > 0 {
-		maxSkew := int64(s.Cfg.TimeSkewMS + s.Cfg.ClickGraceMS)
-		if maxSkew < 3000 {
-			maxSkew = 3000
-		}
-		diff := clientTS - now
-		if diff < 0 {
-			diff = -diff
-		}
-		if diff <= maxSkew {
-			effectiveNow = clientTS
+	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
+		if s.clickLateJoinDenied(ctx, rt.Round, uid, now, joins) {
+			return 0, 0, false, errLateJoinClosed
 		}
 	}
-	delta, total, isBomb, err := s.Game.ValidateClick(ctx, uid, roundID, dropID, effectiveNow)
+	effectiveNow := s.clickTime(clock, clientTS, now)
+	res, err := s.Game.ValidateClick(ctx, uid, roundID, dropID, effectiveNow)
 	if err != nil {
 		return 0, 0, false, err
 	}
+	delta, total, isBomb := res.Delta, res.Total, res.IsBomb
+	if res.IsBomb || res.IsBig {
+		s.recordScreenEvent(roundID, uid, delta, isBomb, now)
+	}
 
 	// 写入点击流（可选）
 	if s.Cfg.ClickStreamEnabled {
@@ -229,6 +244,8 @@ func (s *Server) processClick(ctx context.Context, uid int64, roundID int64, dro
 				"delta":   delta,
 				"bomb":    boolToInt(isBomb),
 				"ts":      now,
+				"eff":     effectiveNow,
+				"start":   res.DropStartMS,
 			},
 		})
 		pipe.Expire(ctx, clickStreamKey(roundID), s.roundKeyTTL(roundID))
@@ -239,20 +256,66 @@ func (s *Server) processClick(ctx context.Context, uid int64, roundID int64, dro
 	return delta, total, isBomb, nil
 }
 
-func (s *Server) gameSignKey(sessionID string) ([]byte, bool) {
+// gameSignKey 点击签名密钥，按 会话+轮次+轮次种子 派生，每轮（每次开始）轮换
+func (s *Server) gameSignKey(sessionID string, roundID int64, seed uint32) ([]byte, bool) {
 	secret := strings.TrimSpace(s.Cfg.GameSignSecret)
 	if secret == "" || secret == "change-me" {
 		return nil, false
 	}
 	sessionID = strings.TrimSpace(sessionID)
-	if sessionID == "" {
+	if sessionID == "" || roundID <= 0 {
 		return nil, false
 	}
 	h := hmac.New(sha256.New, []byte(secret))
-	_, _ = h.Write([]byte(sessionID))
+	_, _ = h.Write([]byte(fmt.Sprintf("%s|%d|%d", sessionID, roundID, seed)))
 	return h.Sum(nil), true
 }
 
+// currentSignKey 当前轮次的签名密钥（hex），无进行中轮次时返回空
+func (s *Server) currentSignKey(sessionID string) (int64, string) {
+	rt := s.Game.GetCurrent()
+	if rt == nil {
+		return 0, ""
+	}
+	key, ok := s.gameSignKey(sessionID, rt.Round.ID, rt.Round.Seed)
+	if !ok {
+		return 0, ""
+	}
+	return rt.Round.ID, hex.EncodeToString(key)
+}
+
+var clickNonceLua = redis.NewScript(`
+local last = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local nonce = tonumber(ARGV[2])
+if nonce <= last then
+  return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+var errNonceReused = errors.New("nonce reused")
+
+// consumeClickNonce 每个会话在每轮内的 nonce 必须严格递增，重放或乱序的点击一律拒绝（WS 与 HTTP 共用）
+func (s *Server) consumeClickNonce(ctx context.Context, sessionID string, roundID int64, nonce int64) error {
+	if nonce <= 0 {
+		return errors.New("invalid nonce")
+	}
+	ok, err := clickNonceLua.Run(ctx, s.Redis, []string{clickNonceKey(roundID)}, sessionID, nonce, s.roundKeyTTL(roundID).Milliseconds()).Int()
+	if err != nil {
+		return errors.New("nonce check failed")
+	}
+	if ok == 0 {
+		return errNonceReused
+	}
+	return nil
+}
+
+func clickNonceKey(roundID int64) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":nonces"
+}
+
 func seedCommit(seed uint32, salt string) string {
 	if salt == "" {
 		return ""
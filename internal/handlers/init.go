@@ -68,6 +68,14 @@ func (s *Server) InitReset(c *gin.Context) {
 			"wallets",
 			"withdraw_requests",
 			"user_alipay_accounts",
+			"roster_tags",
+			"roster_employees",
+			"round_adjustments",
+			"round_agenda",
+			"round_checkins",
+			"round_exclusions",
+			"round_status_history",
+			"round_templates",
 			"round_whitelist",
 			"rounds",
 			"users",
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+const (
+	lateJoinAllow   = "ALLOW"
+	lateJoinDeny    = "DENY"
+	lateJoinProrate = "PRORATE"
+)
+
+var errLateJoinClosed = errors.New("late join closed")
+
+// normalizeLateJoinConfig 校验中途加入策略，默认允许
+func normalizeLateJoinConfig(req *createRoundRequest) error {
+	req.LateJoin = strings.ToUpper(strings.TrimSpace(req.LateJoin))
+	switch req.LateJoin {
+	case "", lateJoinAllow:
+		req.LateJoin = lateJoinAllow
+		req.LateJoinSec = 0
+	case lateJoinDeny:
+		if req.LateJoinSec < 0 || req.LateJoinSec > req.DurationSec {
+			return errors.New("late_join_sec must be between 0 and duration_sec")
+		}
+	case lateJoinProrate:
+		req.LateJoinSec = 0
+	default:
+		return errors.New("invalid late_join")
+	}
+	return nil
+}
+
+// roundInPlay 倒计时、进行中与暂停：切片已生成，记录加入时间并播放观战动画
+func roundInPlay(status models.RoundStatus) bool {
+	return status == models.RoundCountdown || status == models.RoundRunning || status == models.RoundPaused
+}
+
+// recordRoundJoins 记录白名单用户首次在场的时间并返回各自的加入时间（毫秒），已记录的保持不变
+func (s *Server) recordRoundJoins(ctx context.Context, roundID int64, userIDs []int64, now int64) map[int64]int64 {
+	out := make(map[int64]int64, len(userIDs))
+	if s.Redis == nil || len(userIDs) == 0 {
+		return out
+	}
+	key := roundJoinedKey(roundID)
+	fields := make([]string, len(userIDs))
+	pipe := s.Redis.Pipeline()
+	for i, uid := range userIDs {
+		fields[i] = scoreMember(uid)
+		pipe.HSetNX(ctx, key, fields[i], now)
+	}
+	pipe.Expire(ctx, key, s.roundKeyTTL(roundID))
+	get := pipe.HMGet(ctx, key, fields...)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return out
+	}
+	for i, v := range get.Val() {
+		if str, ok := v.(string); ok {
+			if ms, err := strconv.ParseInt(str, 10, 64); err == nil {
+				out[userIDs[i]] = ms
+			}
+		}
+	}
+	return out
+}
+
+// seedRoundJoins 进入倒计时时把已在场的白名单用户记为开始前加入
+func (s *Server) seedRoundJoins(ctx context.Context, roundID int64) {
+	if s.Redis == nil {
+		return
+	}
+	now := time.Now().UnixMilli()
+	minScore := strconv.FormatInt(now-onlineTTLMS, 10)
+	vals, err := s.Redis.ZRangeByScore(ctx, roundPresentKey(roundID), &redis.ZRangeBy{Min: minScore, Max: "+inf"}).Result()
+	if err != nil || len(vals) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(vals))
+	for _, v := range vals {
+		if uid, err := strconv.ParseInt(v, 10, 64); err == nil {
+			ids = append(ids, uid)
+		}
+	}
+	s.recordRoundJoins(ctx, roundID, ids, now)
+}
+
+// lateJoinDeadline DENY 策略下允许加入的截止时间
+func lateJoinDeadline(round models.Round) int64 {
+	return round.StartAtMS + int64(round.LateJoinSec)*1000
+}
+
+// filterLateJoin DENY 策略下把超过截止时间才加入的白名单用户改为不可参与（观战）
+func (s *Server) filterLateJoin(ctx context.Context, round models.Round, eligibleMap map[int64]bool, now int64) {
+	if round.LateJoin != lateJoinDeny || !roundInPlay(round.Status) {
+		return
+	}
+	ids := make([]int64, 0, len(eligibleMap))
+	for uid, ok := range eligibleMap {
+		if ok {
+			ids = append(ids, uid)
+		}
+	}
+	deadline := lateJoinDeadline(round)
+	for uid, joined := range s.recordRoundJoins(ctx, round.ID, ids, now) {
+		if joined > deadline {
+			eligibleMap[uid] = false
+		}
+	}
+}
+
+// lateJoinDenied 单个白名单用户是否因加入过晚而不可参与
+func (s *Server) lateJoinDenied(ctx context.Context, round models.Round, uid int64, now int64) bool {
+	flags := map[int64]bool{uid: true}
+	s.filterLateJoin(ctx, round, flags, now)
+	return !flags[uid]
+}
+
+// lateJoinCache WS 连接缓存的本轮加入时间，仅在读循环内访问；加入时间首次记录后不再变化
+type lateJoinCache struct {
+	roundID  int64
+	joinedMS int64
+}
+
+// clickLateJoinDenied 点击路径的加入截止校验：每个连接每轮只查一次 Redis，HTTP 点击（cache 为 nil）每次查询
+func (s *Server) clickLateJoinDenied(ctx context.Context, round models.Round, uid int64, now int64, cache *lateJoinCache) bool {
+	if round.LateJoin != lateJoinDeny || !roundInPlay(round.Status) {
+		return false
+	}
+	if cache != nil && cache.roundID == round.ID {
+		return cache.joinedMS > lateJoinDeadline(round)
+	}
+	joined, ok := s.recordRoundJoins(ctx, round.ID, []int64{uid}, now)[uid]
+	if !ok {
+		return false
+	}
+	if cache != nil {
+		*cache = lateJoinCache{roundID: round.ID, joinedMS: joined}
+	}
+	return joined > lateJoinDeadline(round)
+}
+
+// currentSlicePayloads 跳过已经结束的切片（含最后一批红包的可见窗口），中途加入只下发当前及之后的切片
+func currentSlicePayloads(payloads []slicePayload, now int64) []slicePayload {
+	for i, p := range payloads {
+		if p.StartAtMS+int64(p.DurationMS)+int64(p.WindowMS) > now {
+			return payloads[i:]
+		}
+	}
+	return payloads[len(payloads):]
+}
+
+// sliceCutoffMS 判断切片是否已结束的参考时间；暂停期间按暂停时刻，恢复后未结束的切片会整体后移
+func sliceCutoffMS(round models.Round) int64 {
+	if round.Status == models.RoundPaused && round.PausedAtMS > 0 {
+		return round.PausedAtMS
+	}
+	return time.Now().UnixMilli()
+}
+
+// presenceFactors PRORATE 策略下每个用户在场时长占比（加入时间到结束），开始前加入的为 1；没有记录的用户不折算
+func (s *Server) presenceFactors(ctx context.Context, round models.Round) map[int64]float64 {
+	out := make(map[int64]float64)
+	total := round.EndAtMS - round.StartAtMS
+	if round.LateJoin != lateJoinProrate || s.Redis == nil || total <= 0 {
+		return out
+	}
+	all, err := s.Redis.HGetAll(ctx, roundJoinedKey(round.ID)).Result()
+	if err != nil {
+		return out
+	}
+	for member, v := range all {
+		uid := parseUserID(member)
+		joined, err := strconv.ParseInt(v, 10, 64)
+		if uid <= 0 || err != nil {
+			continue
+		}
+		joined = max(joined, round.StartAtMS)
+		out[uid] = min(max(float64(round.EndAtMS-joined)/float64(total), 0), 1)
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+const (
+	defaultLeaderboardIntervalMS = 1000
+	minLeaderboardIntervalMS     = 1000
+	maxLeaderboardIntervalMS     = 2000
+	defaultLeaderboardTopN       = 10
+	maxLeaderboardTopN           = 50
+)
+
+type leaderboardEntry struct {
+	Rank       int    `json:"rank"`
+	UserID     int64  `json:"user_id"`
+	Name       string `json:"name"`
+	Department string `json:"department,omitempty"`
+	Team       string `json:"team,omitempty"`
+	AvatarURL  string `json:"avatar_url"`
+	Score      int    `json:"score"`
+}
+
+// normalizeLeaderboardConfig 补全并限制轮次的排行榜推送配置
+func normalizeLeaderboardConfig(intervalMS, topN int) (int, int) {
+	if intervalMS <= 0 {
+		intervalMS = defaultLeaderboardIntervalMS
+	}
+	if intervalMS < minLeaderboardIntervalMS {
+		intervalMS = minLeaderboardIntervalMS
+	}
+	if intervalMS > maxLeaderboardIntervalMS {
+		intervalMS = maxLeaderboardIntervalMS
+	}
+	if topN <= 0 {
+		topN = defaultLeaderboardTopN
+	}
+	if topN > maxLeaderboardTopN {
+		topN = maxLeaderboardTopN
+	}
+	return intervalMS, topN
+}
+
+// startLeaderboardPush 在 RUNNING 期间按轮次配置周期推送排行榜，轮次结束后补发一次终榜
+func (s *Server) startLeaderboardPush(roundID int64) {
+	if s.Redis == nil {
+		return
+	}
+	if _, loaded := s.leaderboardPushers.LoadOrStore(roundID, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer s.leaderboardPushers.Delete(roundID)
+		rt := s.Game.GetCurrent()
+		if rt == nil || rt.Round.ID != roundID {
+			return
+		}
+		intervalMS, _ := normalizeLeaderboardConfig(rt.Round.LeaderboardIntervalMS, rt.Round.LeaderboardTopN)
+		ticker := time.NewTicker(time.Duration(intervalMS) * time.Millisecond)
+		defer ticker.Stop()
+		s.pushLeaderboard(rt.Round)
+		for range ticker.C {
+			rt := s.Game.GetCurrent()
+			if rt == nil || rt.Round.ID != roundID {
+				return
+			}
+			s.pushLeaderboard(rt.Round)
+			if rt.Round.Status != models.RoundRunning {
+				return
+			}
+		}
+	}()
+}
+
+// topLeaderboard 读取轮次前 n 名及参与得分的总人数
+func (s *Server) topLeaderboard(ctx context.Context, roundID int64, n int) ([]leaderboardEntry, int64, error) {
+	items, err := s.Redis.ZRevRangeWithScores(ctx, scoreZSetKey(roundID), 0, int64(n-1)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	totalUsers, _ := s.Redis.ZCard(ctx, scoreZSetKey(roundID)).Result()
+	userIDs := make([]int64, 0, len(items))
+	for _, item := range items {
+		if uid := parseUserID(item.Member); uid > 0 {
+			userIDs = append(userIDs, uid)
+		}
+	}
+	infoMap := s.getUsersByIDs(userIDs)
+	// 非团队赛时 hash 不存在，全部为空
+	teams := make([]interface{}, len(items))
+	if len(items) > 0 {
+		fields := make([]string, len(items))
+		for i, item := range items {
+			fields[i], _ = item.Member.(string)
+		}
+		if vals, err := s.Redis.HMGet(ctx, teamsKey(roundID), fields...).Result(); err == nil {
+			teams = vals
+		}
+	}
+	entries := make([]leaderboardEntry, 0, len(items))
+	for i, item := range items {
+		uid := parseUserID(item.Member)
+		info := infoMap[uid]
+		team, _ := teams[i].(string)
+		entries = append(entries, leaderboardEntry{
+			Rank:       i + 1,
+			UserID:     uid,
+			Name:       publicName(info),
+			Department: info.Department,
+			Team:       team,
+			AvatarURL:  info.AvatarURL,
+			Score:      int(item.Score),
+		})
+	}
+	return entries, totalUsers, nil
+}
+
+func (s *Server) pushLeaderboard(round models.Round) {
+	ctx := context.Background()
+	_, topN := normalizeLeaderboardConfig(round.LeaderboardIntervalMS, round.LeaderboardTopN)
+	entries, totalUsers, err := s.topLeaderboard(ctx, round.ID, topN)
+	if err != nil {
+		return
+	}
+	now := time.Now().UnixMilli()
+	var teamRanks map[string]teamEntry
+	if round.TeamMode != "" {
+		teamRanks = s.pushTeamLeaderboard(ctx, round, now)
+	}
+	s.Hub.Broadcast(mustJSON(WSMessage{
+		Type: "leaderboard",
+		Data: map[string]interface{}{
+			"round_id":    round.ID,
+			"items":       entries,
+			"total_users": totalUsers,
+			"server_time": now,
+		},
+	}))
+
+	// 个人排名：对在线用户批量 ZREVRANK，未得分的用户不推送
+	onlineIDs := s.Hub.UserIDs()
+	if len(onlineIDs) == 0 {
+		return
+	}
+	pipe := s.Redis.Pipeline()
+	rankCmds := make([]*redis.IntCmd, len(onlineIDs))
+	scoreCmds := make([]*redis.FloatCmd, len(onlineIDs))
+	teamCmds := make([]*redis.StringCmd, len(onlineIDs))
+	for i, uid := range onlineIDs {
+		rankCmds[i] = pipe.ZRevRank(ctx, scoreZSetKey(round.ID), scoreMember(uid))
+		scoreCmds[i] = pipe.ZScore(ctx, scoreZSetKey(round.ID), scoreMember(uid))
+		if teamRanks != nil {
+			teamCmds[i] = pipe.HGet(ctx, teamsKey(round.ID), scoreMember(uid))
+		}
+	}
+	_, _ = pipe.Exec(ctx)
+	for i, uid := range onlineIDs {
+		rank, err := rankCmds[i].Result()
+		if err != nil {
+			continue
+		}
+		data := map[string]interface{}{
+			"round_id":    round.ID,
+			"rank":        rank + 1,
+			"score":       int(scoreCmds[i].Val()),
+			"total_users": totalUsers,
+			"server_time": now,
+		}
+		if teamCmds[i] != nil {
+			if team, err := teamCmds[i].Result(); err == nil {
+				data["team"] = team
+				if e, ok := teamRanks[team]; ok {
+					data["team_rank"] = e.Rank
+					data["team_score"] = e.Score
+				}
+			}
+		}
+		s.Hub.SendToUser(uid, mustJSON(WSMessage{Type: "my_rank", Data: data}))
+	}
+}
@@ -45,6 +45,7 @@ func (s *Server) AdminRequired() gin.HandlerFunc {
 		// 支持管理员Token
 		adminToken := c.GetHeader("X-Admin-Token")
 		if adminToken != "" && adminToken == s.Cfg.AdminToken {
+			c.Set("admin_token", true)
 			c.Next()
 			return
 		}
@@ -71,6 +72,7 @@ func (s *Server) AdminRequired() gin.HandlerFunc {
 		c.Set("uid", claims.UserID)
 		c.Set("phone", claims.Phone)
 		c.Set("admin", true)
+		c.Set("sid", claims.SessionID)
 		c.Next()
 	}
 }
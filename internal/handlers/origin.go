@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/auth"
+)
+
+// originAllowed 校验浏览器来源（WebSocket 与 /api 跨域共用）：
+// DEV_MODE 放行全部；未携带 Origin（非浏览器客户端）放行；
+// 未配置 ALLOWED_ORIGINS 时仅允许同源，否则按白名单匹配，支持 *.example.com 通配子域名。
+func (s *Server) originAllowed(r *http.Request) bool {
+	if s.Cfg.DevMode {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if len(s.Cfg.AllowedOrigins) == 0 {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+	for _, pattern := range s.Cfg.AllowedOrigins {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin 匹配单条规则：可带协议（https://a.com）或仅主机（a.com），主机可用 *. 前缀匹配任意子域名；
+// 规则写了端口（a.com:8443）时端口须一致，未写端口时不限制端口
+func matchOrigin(pattern string, origin *url.URL) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+	if pattern == "*" {
+		return true
+	}
+	hostPattern := pattern
+	if idx := strings.Index(pattern, "://"); idx >= 0 {
+		if pattern[:idx] != strings.ToLower(origin.Scheme) {
+			return false
+		}
+		hostPattern = pattern[idx+3:]
+	}
+	hostPattern = strings.TrimSuffix(hostPattern, "/")
+	portPattern := ""
+	if h, p, err := net.SplitHostPort(hostPattern); err == nil {
+		hostPattern, portPattern = h, p
+	}
+	if portPattern != "" && portPattern != origin.Port() {
+		return false
+	}
+	host := strings.ToLower(origin.Hostname())
+	if strings.HasPrefix(hostPattern, "*.") {
+		return strings.HasSuffix(host, hostPattern[1:])
+	}
+	return host == hostPattern
+}
+
+// requestUserID 尽力解析请求携带的用户 token（?token= 或 Bearer），仅用于日志，失败返回 0
+func (s *Server) requestUserID(r *http.Request) int64 {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = getBearerToken(r)
+	}
+	if token == "" {
+		return 0
+	}
+	claims, err := auth.ParseToken(s.JWTSecret, token)
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+func (s *Server) logRejectedOrigin(r *http.Request, userID int64) {
+	log.Printf("origin rejected: uid=%d origin=%q path=%s remote=%s", userID, r.Header.Get("Origin"), r.URL.Path, r.RemoteAddr)
+}
+
+// CORS /api 跨域中间件，允许来源与 WebSocket 一致
+func (s *Server) CORS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		if !s.originAllowed(c.Request) {
+			s.logRejectedOrigin(c.Request, s.requestUserID(c.Request))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+			return
+		}
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Admin-Token, X-Init-Secret, X-Remote-Key, X-Screen-Key")
+		h.Set("Access-Control-Max-Age", "600")
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
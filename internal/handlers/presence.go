@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	onlineTTLMS           = 20000
+	presenceTouchMS       = 2000
+	presenceTrimInterval  = 10 * time.Second
+	presenceTouchCleanAge = 5 * time.Minute
+)
+
+// MarkOnline 刷新用户最后活跃时间（有序集合，score=毫秒时间戳）；
+// 若用户在当前轮次白名单内，同时写入该轮次的在场集合，用于 online_count。
+func (s *Server) MarkOnline(userID int64) {
+	if s.Redis == nil {
+		return
+	}
+	if userID <= 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	if val, ok := s.onlineTouch.Load(userID); ok {
+		if last, ok := val.(int64); ok && now-last < presenceTouchMS {
+			return
+		}
+	}
+	s.onlineTouch.Store(userID, now)
+	ctx := context.Background()
+	member := redis.Z{Score: float64(now), Member: userID}
+	_ = s.Redis.ZAdd(ctx, onlineUsersKey(), member).Err()
+	if rt := s.Game.GetCurrent(); rt != nil {
+		// 只查 Redis 白名单，避免非白名单用户每次心跳都回源 DB
+		if ok, _ := s.Redis.SIsMember(ctx, whitelistKey(rt.Round.ID), userID).Result(); ok {
+			_ = s.Redis.ZAdd(ctx, roundPresentKey(rt.Round.ID), member).Err()
+			if roundInPlay(rt.Round.Status) {
+				s.recordRoundJoins(ctx, rt.Round.ID, []int64{userID}, now)
+			}
+		}
+	}
+}
+
+func (s *Server) getActiveOnlineUserIDs(ctx context.Context) []int64 {
+	minScore := strconv.FormatInt(time.Now().UnixMilli()-onlineTTLMS, 10)
+	vals, err := s.Redis.ZRangeByScore(ctx, onlineUsersKey(), &redis.ZRangeBy{Min: minScore, Max: "+inf"}).Result()
+	if err != nil {
+		return nil
+	}
+	active := make([]int64, 0, len(vals))
+	for _, v := range vals {
+		if uid, err := strconv.ParseInt(v, 10, 64); err == nil {
+			active = append(active, uid)
+		}
+	}
+	return active
+}
+
+// onlineCount 当前轮次在场且在白名单内的人数；无轮次时返回全站在线人数
+func (s *Server) onlineCount(ctx context.Context, roundID int64) int {
+	if s.Redis == nil {
+		return 0
+	}
+	key := onlineUsersKey()
+	if roundID > 0 {
+		key = roundPresentKey(roundID)
+	}
+	minScore := strconv.FormatInt(time.Now().UnixMilli()-onlineTTLMS, 10)
+	n, _ := s.Redis.ZCount(ctx, key, minScore, "+inf").Result()
+	return int(n)
+}
+
+// seedRoundPresence 白名单导入 Redis 后，把已在线的白名单用户补进在场集合
+func (s *Server) seedRoundPresence(ctx context.Context, roundID int64) {
+	minScore := strconv.FormatInt(time.Now().UnixMilli()-onlineTTLMS, 10)
+	online, err := s.Redis.ZRangeByScoreWithScores(ctx, onlineUsersKey(), &redis.ZRangeBy{Min: minScore, Max: "+inf"}).Result()
+	if err != nil || len(online) == 0 {
+		return
+	}
+	members := make([]interface{}, len(online))
+	for i, z := range online {
+		members[i] = z.Member
+	}
+	flags, err := s.Redis.SMIsMember(ctx, whitelistKey(roundID), members...).Result()
+	if err != nil || len(flags) != len(online) {
+		return
+	}
+	present := make([]redis.Z, 0, len(online))
+	for i, ok := range flags {
+		if ok {
+			present = append(present, online[i])
+		}
+	}
+	if len(present) > 0 {
+		_ = s.Redis.ZAdd(ctx, roundPresentKey(roundID), present...).Err()
+	}
+}
+
+// startPresenceTrimmer 定期清理过期的在线/在场记录
+func (s *Server) startPresenceTrimmer() {
+	if s == nil || s.Redis == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(presenceTrimInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.trimPresence()
+		}
+	}()
+}
+
+func (s *Server) trimPresence() {
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	maxScore := "(" + strconv.FormatInt(now-onlineTTLMS, 10)
+	pipe := s.Redis.Pipeline()
+	pipe.ZRemRangeByScore(ctx, onlineUsersKey(), "-inf", maxScore)
+	if rt := s.Game.GetCurrent(); rt != nil {
+		pipe.ZRemRangeByScore(ctx, roundPresentKey(rt.Round.ID), "-inf", maxScore)
+	}
+	_, _ = pipe.Exec(ctx)
+
+	staleBefore := now - presenceTouchCleanAge.Milliseconds()
+	s.onlineTouch.Range(func(key, value any) bool {
+		if last, ok := value.(int64); !ok || last < staleBefore {
+			s.onlineTouch.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errClickRateLimited 点击超出限速，客户端据此区分于校验失败
+var errClickRateLimited = errors.New("rate_limited")
+
+const rateLimiterIdleMS = 60000
+
+type tokenBucket struct {
+	tokens float64
+	lastMS int64
+}
+
+// rateLimiter 内存令牌桶，rate 为每秒补充的令牌数，burst 为桶容量
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rate float64, burst float64) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *rateLimiter) allow(key string, nowMS int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, lastMS: nowMS}
+		l.buckets[key] = b
+	}
+	if elapsed := nowMS - b.lastMS; elapsed > 0 {
+		b.tokens += float64(elapsed) * l.rate / 1000
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.lastMS = nowMS
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep 清理长时间未使用（已回满）的桶
+func (l *rateLimiter) sweep(nowMS int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if nowMS-b.lastMS > rateLimiterIdleMS {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+var tokenBucketLua = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil then
+  tokens = burst
+  last = now
+end
+if now > last then
+  tokens = math.min(burst, tokens + (now - last) * rate / 1000)
+  last = now
+end
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 't', tokens, 'ts', last)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return allowed
+`)
+
+// clickLimiter 点击限速：按用户与按 IP 两级令牌桶，可选 Redis 后端（多实例部署时共享）
+type clickLimiter struct {
+	user        *rateLimiter
+	ip          *rateLimiter
+	userLimited atomic.Int64
+	ipLimited   atomic.Int64
+}
+
+func (s *Server) initClickLimiter() {
+	if s.Cfg.ClickRatePerSec > 0 {
+		s.clickLimit.user = newRateLimiter(s.Cfg.ClickRatePerSec, s.Cfg.ClickRateBurst)
+	}
+	if s.Cfg.ClickIPRatePerSec > 0 {
+		s.clickLimit.ip = newRateLimiter(s.Cfg.ClickIPRatePerSec, s.Cfg.ClickIPRateBurst)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now().UnixMilli()
+			if s.clickLimit.user != nil {
+				s.clickLimit.user.sweep(now)
+			}
+			if s.clickLimit.ip != nil {
+				s.clickLimit.ip.sweep(now)
+			}
+		}
+	}()
+}
+
+// allowClick 在签名校验与计分之前调用；超限返回 errClickRateLimited 并计数
+func (s *Server) allowClick(ctx context.Context, uid int64, ip string) error {
+	now := time.Now().UnixMilli()
+	if l := s.clickLimit.user; l != nil && !s.takeToken(ctx, l, "u:"+strconv.FormatInt(uid, 10), now) {
+		s.clickLimit.userLimited.Add(1)
+		return errClickRateLimited
+	}
+	if l := s.clickLimit.ip; l != nil && ip != "" && !s.takeToken(ctx, l, "ip:"+ip, now) {
+		s.clickLimit.ipLimited.Add(1)
+		return errClickRateLimited
+	}
+	return nil
+}
+
+func (s *Server) takeToken(ctx context.Context, l *rateLimiter, key string, nowMS int64) bool {
+	if s.Cfg.ClickRateLimitRedis && s.Redis != nil {
+		ttl := int64(l.burst/l.rate*1000) + 1000
+		ok, err := tokenBucketLua.Run(ctx, s.Redis, []string{"ratelimit:click:" + key}, l.rate, l.burst, nowMS, ttl).Int()
+		if err == nil {
+			return ok == 1
+		}
+		// Redis 异常时退回本地限速
+	}
+	return l.allow(key, nowMS)
+}
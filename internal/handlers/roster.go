@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxRosterNameLen       = 32
+	maxEmployeeNoLen       = 32
+	maxRosterTagLen        = 32
+	maxRosterTagsPerPerson = 20
+)
+
+// rosterEntry 花名册一行：phone, name, department, employee_no, tags
+type rosterEntry struct {
+	Phone      string
+	Name       string
+	Department string
+	EmployeeNo string
+	Tags       []string
+}
+
+type rosterItem struct {
+	UserID     int64     `json:"user_id"`
+	Phone      string    `json:"phone"`
+	Name       string    `json:"name"`
+	Department string    `json:"department"`
+	EmployeeNo string    `json:"employee_no"`
+	Tags       []string  `json:"tags"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type rosterFacet struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type rosterWhitelistRequest struct {
+	Departments []string `json:"departments"`
+	Tags        []string `json:"tags"`
+}
+
+// splitRosterTags 标签可用 ; | 、 ， 或逗号分隔，去重并保持顺序
+func splitRosterTags(raw string) ([]string, error) {
+	parts := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ';' || r == '|' || r == ',' || r == '，' || r == '、' || r == '；'
+	})
+	tags := make([]string, 0, len(parts))
+	seen := make(map[string]bool, len(parts))
+	for _, p := range parts {
+		tag := strings.TrimSpace(p)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxRosterTagLen {
+			return nil, fmt.Errorf("tag too long")
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxRosterTagsPerPerson {
+		return nil, fmt.Errorf("too many tags (max %d)", maxRosterTagsPerPerson)
+	}
+	return tags, nil
+}
+
+// parseRosterRows 校验并去重（同一手机号以最后一行为准），非法行记入 skipped；rows[i] 对应第 i+1 行
+func parseRosterRows(rows [][]string) ([]rosterEntry, []importSkip, error) {
+	entries := make([]rosterEntry, 0, len(rows))
+	index := make(map[string]int)
+	skipped := make([]importSkip, 0)
+	skip := func(line int, reason string) {
+		if len(skipped) < maxImportSkipped {
+			skipped = append(skipped, importSkip{Line: line, Reason: reason})
+		}
+	}
+	field := func(record []string, i int) string {
+		if i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for i, record := range rows {
+		line := i + 1
+		phone := field(record, 0)
+		if phone == "" {
+			continue
+		}
+		if !validPhone(phone) {
+			// 首行为表头
+			if line > 1 {
+				skip(line, "invalid phone")
+			}
+			continue
+		}
+		e := rosterEntry{
+			Phone:      phone,
+			Name:       field(record, 1),
+			Department: field(record, 2),
+			EmployeeNo: field(record, 3),
+		}
+		switch {
+		case len([]rune(e.Name)) > maxRosterNameLen:
+			skip(line, "name too long")
+			continue
+		case len([]rune(e.Department)) > maxDepartmentLen:
+			skip(line, "department too long")
+			continue
+		case len(e.EmployeeNo) > maxEmployeeNoLen:
+			skip(line, "employee_no too long")
+			continue
+		}
+		tags, err := splitRosterTags(field(record, 4))
+		if err != nil {
+			skip(line, err.Error())
+			continue
+		}
+		e.Tags = tags
+		if j, ok := index[phone]; ok {
+			entries[j] = e
+			continue
+		}
+		if len(entries) >= maxWhitelistImportRows {
+			return nil, nil, fmt.Errorf("too many rows (max %d)", maxWhitelistImportRows)
+		}
+		index[phone] = len(entries)
+		entries = append(entries, e)
+	}
+	return entries, skipped, nil
+}
+
+// readRosterRows 按文件头识别 XLSX，否则按 CSV 解析
+func readRosterRows(data []byte) ([][]string, error) {
+	if isXLSX(data) {
+		return readXLSXRows(data)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv error: %v", err)
+	}
+	return rows, nil
+}
+
+// ImportRoster 导入花名册（CSV 或 XLSX），按手机号关联用户；重复导入覆盖同一员工的资料与标签
+func (s *Server) ImportRoster(c *gin.Context) {
+	data, err := readUpload(c, maxWhitelistImportBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := readRosterRows(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, skipped, err := parseRosterRows(rows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty roster", "skipped": skipped})
+		return
+	}
+
+	// 建档并同步 users.department，昵称不使用真实姓名
+	userEntries := make([]whitelistEntry, len(entries))
+	for i, e := range entries {
+		userEntries[i] = whitelistEntry{Phone: e.Phone, Department: e.Department}
+	}
+	userIDs, err := s.upsertWhitelistUsers(userEntries)
+	if err != nil || len(userIDs) != len(entries) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user error"})
+		return
+	}
+	created, err := s.upsertRoster(entries, userIDs, adminOperator(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(entries), "created": created, "updated": len(entries) - created, "skipped": skipped})
+}
+
+// upsertRoster 分批写入员工资料并整体替换其标签，返回新建的员工数
+func (s *Server) upsertRoster(entries []rosterEntry, userIDs []int64, operator string) (int, error) {
+	created := 0
+	for start := 0; start < len(entries); start += whitelistBatchSize {
+		end := min(start+whitelistBatchSize, len(entries))
+		batch := entries[start:end]
+		ids := make([]interface{}, 0, len(batch))
+		for _, uid := range userIDs[start:end] {
+			ids = append(ids, uid)
+		}
+		var existing int
+		if err := s.DB.QueryRow(`SELECT COUNT(1) FROM roster_employees WHERE user_id IN (`+sqlPlaceholders(len(ids), "?")+`)`, ids...).Scan(&existing); err != nil {
+			return created, err
+		}
+
+		args := make([]interface{}, 0, len(batch)*6)
+		tagArgs := make([]interface{}, 0)
+		tagRows := 0
+		for i, e := range batch {
+			uid := userIDs[start+i]
+			args = append(args, uid, e.Phone, e.Name, e.Department, e.EmployeeNo, operator)
+			for _, tag := range e.Tags {
+				tagArgs = append(tagArgs, uid, tag)
+				tagRows++
+			}
+		}
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return created, err
+		}
+		if _, err := tx.Exec(`INSERT INTO roster_employees (user_id, phone, name, department, employee_no, operator, created_at, updated_at) VALUES `+
+			sqlPlaceholders(len(batch), "(?, ?, ?, ?, ?, ?, NOW(), NOW())")+`
+			ON DUPLICATE KEY UPDATE phone = VALUES(phone), name = VALUES(name), department = VALUES(department),
+			employee_no = VALUES(employee_no), operator = VALUES(operator), updated_at = NOW()`, args...); err != nil {
+			_ = tx.Rollback()
+			return created, err
+		}
+		if _, err := tx.Exec(`DELETE FROM roster_tags WHERE user_id IN (`+sqlPlaceholders(len(ids), "?")+`)`, ids...); err != nil {
+			_ = tx.Rollback()
+			return created, err
+		}
+		if tagRows > 0 {
+			if _, err := tx.Exec(`INSERT INTO roster_tags (user_id, tag, created_at) VALUES `+
+				sqlPlaceholders(tagRows, "(?, ?, NOW())"), tagArgs...); err != nil {
+				_ = tx.Rollback()
+				return created, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return created, err
+		}
+		created += len(batch) - existing
+	}
+	return created, nil
+}
+
+// rosterTags 批量读取员工标签
+func (s *Server) rosterTags(userIDs []int64) map[int64][]string {
+	tags := make(map[int64][]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return tags
+	}
+	args := make([]interface{}, len(userIDs))
+	for i, uid := range userIDs {
+		args[i] = uid
+	}
+	rows, err := s.DB.Query(`SELECT user_id, tag FROM roster_tags WHERE user_id IN (`+sqlPlaceholders(len(args), "?")+`) ORDER BY tag ASC`, args...)
+	if err != nil {
+		return tags
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid int64
+		var tag string
+		if err := rows.Scan(&uid, &tag); err == nil {
+			tags[uid] = append(tags[uid], tag)
+		}
+	}
+	return tags
+}
+
+// ListRoster 花名册分页列表，可按关键字、部门、标签筛选
+func (s *Server) ListRoster(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	where := ` WHERE 1=1`
+	args := make([]interface{}, 0)
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + q + "%"
+		where += ` AND (e.phone LIKE ? OR e.name LIKE ? OR e.employee_no = ?)`
+		args = append(args, like, like, q)
+	}
+	if dept := strings.TrimSpace(c.Query("department")); dept != "" {
+		where += ` AND e.department = ?`
+		args = append(args, dept)
+	}
+	if tag := strings.TrimSpace(c.Query("tag")); tag != "" {
+		where += ` AND EXISTS (SELECT 1 FROM roster_tags t WHERE t.user_id = e.user_id AND t.tag = ?)`
+		args = append(args, tag)
+	}
+
+	var total int
+	if err := s.DB.QueryRow(`SELECT COUNT(1) FROM roster_employees e`+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	rows, err := s.DB.Query(`SELECT e.user_id, e.phone, e.name, e.department, e.employee_no, e.updated_at FROM roster_employees e`+
+		where+` ORDER BY e.department ASC, e.name ASC, e.user_id ASC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+	items := make([]rosterItem, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var it rosterItem
+		if err := rows.Scan(&it.UserID, &it.Phone, &it.Name, &it.Department, &it.EmployeeNo, &it.UpdatedAt); err == nil {
+			items = append(items, it)
+			ids = append(ids, it.UserID)
+		}
+	}
+	tags := s.rosterTags(ids)
+	for i := range items {
+		items[i].Tags = tags[items[i].UserID]
+		if items[i].Tags == nil {
+			items[i].Tags = []string{}
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": limit, "offset": offset})
+}
+
+func (s *Server) rosterFacets(query string) ([]rosterFacet, error) {
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	facets := make([]rosterFacet, 0)
+	for rows.Next() {
+		var f rosterFacet
+		if err := rows.Scan(&f.Name, &f.Count); err == nil {
+			facets = append(facets, f)
+		}
+	}
+	return facets, nil
+}
+
+// GetRosterFacets 部门与标签及其人数，用于按条件生成白名单
+func (s *Server) GetRosterFacets(c *gin.Context) {
+	departments, err := s.rosterFacets(`SELECT department, COUNT(1) FROM roster_employees WHERE department <> '' GROUP BY department ORDER BY department ASC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	tags, err := s.rosterFacets(`SELECT tag, COUNT(1) FROM roster_tags GROUP BY tag ORDER BY tag ASC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var total int
+	_ = s.DB.QueryRow(`SELECT COUNT(1) FROM roster_employees`).Scan(&total)
+	c.JSON(http.StatusOK, gin.H{"departments": departments, "tags": tags, "total": total})
+}
+
+// DeleteRosterEntry 从花名册移除员工，用户账号与已有白名单保留
+func (s *Server) DeleteRosterEntry(c *gin.Context) {
+	uid, err := parseIDParam(c, "uid")
+	if err != nil || uid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid uid"})
+		return
+	}
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM roster_tags WHERE user_id = ?`, uid); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM roster_employees WHERE user_id = ?`, uid); err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// AddWhitelistFromRoster 按部门、标签筛选花名册加入白名单；同一维度内为或，两个维度之间为且
+func (s *Server) AddWhitelistFromRoster(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req rosterWhitelistRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (len(req.Departments) == 0 && len(req.Tags) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "departments or tags required"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	where := ` WHERE 1=1`
+	args := make([]interface{}, 0, len(req.Departments)+len(req.Tags))
+	if len(req.Departments) > 0 {
+		where += ` AND e.department IN (` + sqlPlaceholders(len(req.Departments), "?") + `)`
+		for _, d := range req.Departments {
+			args = append(args, strings.TrimSpace(d))
+		}
+	}
+	if len(req.Tags) > 0 {
+		where += ` AND EXISTS (SELECT 1 FROM roster_tags t WHERE t.user_id = e.user_id AND t.tag IN (` + sqlPlaceholders(len(req.Tags), "?") + `))`
+		for _, t := range req.Tags {
+			args = append(args, strings.TrimSpace(t))
+		}
+	}
+	rows, err := s.DB.Query(`SELECT e.user_id FROM roster_employees e`+where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	userIDs := make([]int64, 0)
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err == nil {
+			userIDs = append(userIDs, uid)
+		}
+	}
+	_ = rows.Close()
+	if len(userIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no matching employees"})
+		return
+	}
+	added, err := s.addRoundWhitelist(round, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(userIDs), "added": added})
+}
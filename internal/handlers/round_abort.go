@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/models"
+)
+
+// 中止轮次的分数与点击流保留一段时间以便复核
+const abortedArchiveTTL = 7 * 24 * time.Hour
+
+func abortedArchiveKey(roundID int64, name string) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":aborted:" + name
+}
+
+type abortRoundRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AbortRound 中止轮次：停止计分，归档 Redis 分数，记录原因并通知所有客户端
+func (s *Server) AbortRound(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req abortRoundRequest
+	_ = c.ShouldBindJSON(&req)
+	reason := trimAdjustReason(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason required"})
+		return
+	}
+
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	// 可中止的状态由状态机决定：开奖前的已锁定阶段；开奖后的批次走作废流程
+	round.AbortReason = reason
+	if err := s.transitionRound(s.DB, round, models.RoundAborted, adminOperator(c), reason, "abort_reason=?", reason); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.closeCheckinSession(context.Background(), roundID)
+
+	// 先切换内存状态，ValidateClick 随即拒绝新的点击
+	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
+		rt.Round.Status = models.RoundAborted
+		rt.Round.AbortReason = reason
+		s.Game.SetCurrent(rt)
+		s.scheduleRoundEndLocked(roundID, 0)
+	}
+	s.archiveRoundScores(roundID)
+
+	s.broadcastRoundState(*round)
+	s.broadcastClearScreen(roundID, "aborted")
+	c.JSON(http.StatusOK, gin.H{"status": round.Status, "reason": reason})
+}
+
+// archiveRoundScores 把分数、总分与点击流改名为归档 key，不再参与排行与开奖
+func (s *Server) archiveRoundScores(roundID int64) {
+	if s.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	archive := map[string]string{
+		scoreZSetKey(roundID):   abortedArchiveKey(roundID, "scores"),
+		scoreSumKey(roundID):    abortedArchiveKey(roundID, "score_sum"),
+		clickStreamKey(roundID): abortedArchiveKey(roundID, "clicks"),
+		teamScoreKey(roundID):   abortedArchiveKey(roundID, "team_scores"),
+	}
+	for src, dst := range archive {
+		if err := s.Redis.Rename(ctx, src, dst).Err(); err == nil {
+			_ = s.Redis.Expire(ctx, dst, abortedArchiveTTL).Err()
+		}
+	}
+	_ = s.Redis.Del(ctx, roundPresentKey(roundID), clickNonceKey(roundID), roundJoinedKey(roundID)).Err()
+}
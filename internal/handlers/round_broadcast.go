@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/game"
+	"hongbao/internal/models"
+)
+
+const broadcastQueueSize = 256
+
+// roundBroadcaster 串行执行轮次相关推送，保证 round_state / round_slices / clear_screen / round_drawn 的先后顺序，
+// 同时让触发推送的管理端请求无需等待逐用户序列化。入队不阻塞（调用方可能持有 roundCtl.mu）：
+// 队列满时后续推送按序进入溢出列表，由推送协程在队列清空后执行，不会丢弃；
+// 溢出期间的 round_state 合并为最新一条。
+type roundBroadcaster struct {
+	once  sync.Once
+	queue chan func()
+
+	mu           sync.Mutex
+	overflow     []func()
+	pendingState *models.Round
+
+	// 以下字段仅在推送协程内访问
+	sliceGen  game.RuntimeGeneration
+	sliceSent map[int64]bool
+}
+
+func (s *Server) startBroadcaster() {
+	b := &s.broadcaster
+	b.once.Do(func() {
+		b.queue = make(chan func(), broadcastQueueSize)
+		go func() {
+			for job := range b.queue {
+				job()
+				for _, next := range s.takeOverflow() {
+					next()
+				}
+			}
+		}()
+	})
+}
+
+// takeOverflow 队列清空后取出溢出的推送；溢出列表非空时新推送只会追加到列表，顺序不变
+func (s *Server) takeOverflow() []func() {
+	b := &s.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.queue) > 0 {
+		return nil
+	}
+	jobs := b.overflow
+	b.overflow = nil
+	return jobs
+}
+
+func (s *Server) enqueueBroadcast(job func()) {
+	b := &s.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.startBroadcaster()
+	if len(b.overflow) == 0 {
+		select {
+		case b.queue <- job:
+			return
+		default:
+			log.Printf("broadcast queue full, deferring pushes")
+		}
+	}
+	b.overflow = append(b.overflow, job)
+}
+
+// flushPendingState 推送溢出期间被合并的最新 round_state，仅在推送协程内调用
+func (s *Server) flushPendingState() {
+	b := &s.broadcaster
+	b.mu.Lock()
+	round := b.pendingState
+	b.pendingState = nil
+	b.mu.Unlock()
+	if round != nil {
+		s.fanOutRoundState(*round)
+	}
+}
+
+// broadcastRoundState 异步推送轮次状态：白名单内/外各序列化一次共享的 round_state，
+// 切片仅在轮次运行时变化（或用户首次具备资格）时以 round_slices 单独下发，并先于状态送达；
+// 白名单外的观众随状态拿到共享的观战切片。
+func (s *Server) broadcastRoundState(round models.Round) {
+	b := &s.broadcaster
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.startBroadcaster()
+	if len(b.overflow) == 0 {
+		select {
+		case b.queue <- func() { s.fanOutRoundState(round) }:
+			return
+		default:
+		}
+	}
+	// 溢出期间只保留最新状态，在第一条被合并状态的位置推送
+	if b.pendingState == nil {
+		b.overflow = append(b.overflow, s.flushPendingState)
+	}
+	b.pendingState = &round
+}
+
+func (s *Server) fanOutRoundState(round models.Round) {
+	rt := s.Game.GetCurrent()
+	if rt != nil && rt.Round.ID != round.ID {
+		rt = nil
+	}
+	ctx := context.Background()
+	onlineCount := s.onlineCount(ctx, round.ID)
+	whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
+	userIDs := s.Hub.UserIDs()
+	if len(userIDs) == 0 {
+		payload := mustJSON(WSMessage{
+			Type: "round_state",
+			Data: s.roundStatePayload(round, rt, nil, onlineCount, int(whitelistCount), 0),
+		})
+		s.Hub.Broadcast(payload)
+		s.pushScreenState()
+		return
+	}
+
+	eligibleMap := s.whitelistFlags(ctx, round.ID, userIDs)
+	s.filterLateJoin(ctx, round, eligibleMap, time.Now().UnixMilli())
+
+	if rt != nil && len(rt.Slices) > 0 && roundSendsSlices(round.Status) {
+		// 运行时换代（暂停恢复、延长）后所有人重新下发
+		b := &s.broadcaster
+		if b.sliceSent == nil || b.sliceGen != rt.Generation() {
+			b.sliceGen = rt.Generation()
+			b.sliceSent = make(map[int64]bool)
+		}
+		pending := make([]int64, 0)
+		for _, uid := range userIDs {
+			if eligibleMap[uid] && !b.sliceSent[uid] {
+				pending = append(pending, uid)
+				b.sliceSent[uid] = true
+			}
+		}
+		s.sendRoundSlices(rt, pending)
+	}
+
+	eligible, ineligible := true, false
+	eligiblePayload := mustJSON(WSMessage{
+		Type: "round_state",
+		Data: s.roundStatePayload(round, nil, &eligible, onlineCount, int(whitelistCount), 0),
+	})
+	ineligiblePayload := mustJSON(WSMessage{
+		Type: "round_state",
+		Data: s.roundStatePayload(round, rt, &ineligible, onlineCount, int(whitelistCount), 0),
+	})
+	for _, uid := range userIDs {
+		if eligibleMap[uid] {
+			s.Hub.SendToUser(uid, eligiblePayload)
+		} else {
+			s.Hub.SendToUser(uid, ineligiblePayload)
+		}
+	}
+	s.pushScreenState()
+}
+
+func roundSendsSlices(status models.RoundStatus) bool {
+	return status == models.RoundRunning || status == models.RoundCountdown || status == models.RoundLocked
+}
+
+// sendRoundSlices 用 worker pool 并发序列化每个用户的切片并下发
+func (s *Server) sendRoundSlices(rt *game.RoundRuntime, userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+	roundID := rt.Round.ID
+	sessions := s.sessionIDs(context.Background(), userIDs)
+	workers := runtime.NumCPU()
+	if workers > len(userIDs) {
+		workers = len(userIDs)
+	}
+	jobs := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for uid := range jobs {
+				data := map[string]interface{}{
+					"round_id": roundID,
+					"slices":   s.userSlicePayloads(rt, uid),
+				}
+				// 新一轮的签名密钥随切片下发
+				if signRoundID, key := s.currentSignKey(sessions[uid]); key != "" && signRoundID == roundID {
+					data["sign_key"] = key
+					data["sign_round_id"] = signRoundID
+				}
+				s.Hub.SendToUser(uid, mustJSON(WSMessage{Type: "round_slices", Data: data}))
+			}
+		}()
+	}
+	for _, uid := range userIDs {
+		jobs <- uid
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// whitelistFlags 批量查询在线用户是否在轮次白名单内
+func (s *Server) whitelistFlags(ctx context.Context, roundID int64, userIDs []int64) map[int64]bool {
+	key := whitelistKey(roundID)
+	members := make([]interface{}, len(userIDs))
+	for i, uid := range userIDs {
+		members[i] = uid
+	}
+	eligibleMap := make(map[int64]bool, len(userIDs))
+
+	// SMIsMember 批量检查 (Redis 6.2+)
+	results, err := s.Redis.SMIsMember(ctx, key, members...).Result()
+	if err == nil && len(results) == len(userIDs) {
+		for i, uid := range userIDs {
+			eligibleMap[uid] = results[i]
+		}
+		return eligibleMap
+	}
+	// 回退：使用 Pipeline 批量查询
+	pipe := s.Redis.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(userIDs))
+	for i, uid := range userIDs {
+		cmds[i] = pipe.SIsMember(ctx, key, uid)
+	}
+	_, _ = pipe.Exec(ctx)
+	for i, uid := range userIDs {
+		eligibleMap[uid] = cmds[i].Val()
+	}
+	return eligibleMap
+}
+
+// sessionIDs 批量读取用户当前会话 ID（每个用户仅保留一个有效会话）
+func (s *Server) sessionIDs(ctx context.Context, userIDs []int64) map[int64]string {
+	out := make(map[int64]string, len(userIDs))
+	if s.Redis == nil || len(userIDs) == 0 {
+		return out
+	}
+	pipe := s.Redis.Pipeline()
+	cmds := make([]*redis.StringCmd, len(userIDs))
+	for i, uid := range userIDs {
+		cmds[i] = pipe.Get(ctx, sessionKey(uid))
+	}
+	_, _ = pipe.Exec(ctx)
+	for i, uid := range userIDs {
+		if sid, err := cmds[i].Result(); err == nil {
+			out[uid] = sid
+		}
+	}
+	return out
+}
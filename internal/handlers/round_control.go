@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/game"
+	"hongbao/internal/models"
+)
+
+const maxExtendSec = 600
+
+// roundControl 串行化运行中轮次的到点结束与管理端暂停/恢复/延长/提前结束
+type roundControl struct {
+	mu    sync.Mutex
+	gen   int64
+	timer *time.Timer
+}
+
+// scheduleRoundEndLocked 重新安排到点进入 READY_DRAW，endAtMS 为 0 时仅取消
+func (s *Server) scheduleRoundEndLocked(roundID int64, endAtMS int64) {
+	ctl := &s.roundCtl
+	if ctl.timer != nil {
+		ctl.timer.Stop()
+		ctl.timer = nil
+	}
+	ctl.gen++
+	if endAtMS <= 0 {
+		return
+	}
+	gen := ctl.gen
+	ctl.timer = time.AfterFunc(time.Until(time.UnixMilli(endAtMS)), func() {
+		ctl.mu.Lock()
+		defer ctl.mu.Unlock()
+		if ctl.gen != gen {
+			return
+		}
+		ctl.timer = nil
+		s.finishRoundLocked(roundID, actorSystem, "time up")
+	})
+}
+
+func (s *Server) scheduleRoundEnd(roundID int64, endAtMS int64) {
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	s.scheduleRoundEndLocked(roundID, endAtMS)
+}
+
+// finishRoundLocked 游戏阶段结束，进入待开奖
+func (s *Server) finishRoundLocked(roundID int64, actor, reason string) {
+	round, _ := s.getRoundByID(roundID)
+	if round == nil {
+		return
+	}
+	if err := s.transitionRound(s.DB, round, models.RoundReadyDraw, actor, reason, ""); err != nil {
+		return
+	}
+	s.syncRuntimeStatus(roundID, models.RoundReadyDraw)
+	s.broadcastRoundState(*round)
+}
+
+// controlRuntime 读取可操作的运行时，失败时已写回响应
+func (s *Server) controlRuntime(c *gin.Context, allowed ...models.RoundStatus) (*game.RoundRuntime, bool) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+	rt := s.Game.GetCurrent()
+	if rt == nil || rt.Round.ID != roundID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round not active"})
+		return nil, false
+	}
+	for _, status := range allowed {
+		if rt.Round.Status == status {
+			return rt, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "round status not allowed"})
+	return nil, false
+}
+
+// applyRuntime 持久化结束时间、总分值（延长会追加切片分值）、暂停时刻与状态（经状态机迁移），
+// 写库成功后才替换运行时并推送新的切片与状态；调用方传入副本，失败时内存保持原状
+func (s *Server) applyRuntime(rt *game.RoundRuntime, actor, reason string) error {
+	round, err := s.getRoundByID(rt.Round.ID)
+	if err != nil {
+		return err
+	}
+	if round.Status != rt.Round.Status {
+		err = s.transitionRound(s.DB, round, rt.Round.Status, actor, reason, "end_at_ms=?, score_total=?, paused_at_ms=?", rt.Round.EndAtMS, rt.Round.ScoreTotal, rt.Round.PausedAtMS)
+	} else {
+		_, err = s.DB.Exec(`UPDATE rounds SET end_at_ms=?, score_total=?, paused_at_ms=?, updated_at=NOW() WHERE id=?`, rt.Round.EndAtMS, rt.Round.ScoreTotal, rt.Round.PausedAtMS, rt.Round.ID)
+	}
+	if err != nil {
+		return err
+	}
+	// 暂停与提前结束不改变切片代次，无需重新预计算
+	regenerated := !rt.SameGeneration(s.Game.GetCurrent())
+	s.Game.SetCurrent(rt)
+	if regenerated {
+		go s.precomputeSlicePayloads(rt)
+	}
+	s.broadcastRoundState(rt.Round)
+	return nil
+}
+
+// PauseRound 暂停进行中的轮次：停止计分与到点结束，客户端停止掉落
+func (s *Server) PauseRound(c *gin.Context) {
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	rt, ok := s.controlRuntime(c, models.RoundRunning)
+	if !ok {
+		return
+	}
+	now := time.Now().UnixMilli()
+	next := *rt
+	next.Round.Status = models.RoundPaused
+	next.Round.PausedAtMS = now
+	if err := s.applyRuntime(&next, adminOperator(c), "paused"); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.scheduleRoundEndLocked(next.Round.ID, 0)
+	c.JSON(http.StatusOK, gin.H{"status": next.Round.Status, "paused_at": now})
+}
+
+// ResumeRound 恢复暂停的轮次，未结束的切片与结束时间顺延暂停时长
+func (s *Server) ResumeRound(c *gin.Context) {
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	rt, ok := s.controlRuntime(c, models.RoundPaused)
+	if !ok {
+		return
+	}
+	// 暂停时刻以库中记录为准，重启后同样能按实际暂停时长顺延
+	round, err := s.getRoundByID(rt.Round.ID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	now := time.Now().UnixMilli()
+	pausedAt := round.PausedAtMS
+	if pausedAt <= 0 || pausedAt > now {
+		pausedAt = now
+	}
+	next := rt.ShiftRemaining(pausedAt, now-pausedAt)
+	next.Round.Status = models.RoundRunning
+	next.Round.PausedAtMS = 0
+	if err := s.applyRuntime(next, adminOperator(c), "resumed"); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.scheduleRoundEndLocked(next.Round.ID, next.Round.EndAtMS)
+	s.startLeaderboardPush(next.Round.ID)
+	c.JSON(http.StatusOK, gin.H{"status": next.Round.Status, "end_at": next.Round.EndAtMS})
+}
+
+type extendRoundRequest struct {
+	Seconds int `json:"seconds"`
+}
+
+// ExtendRound 延长进行中（或暂停中）的轮次，在末尾追加切片
+func (s *Server) ExtendRound(c *gin.Context) {
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	var req extendRoundRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Seconds <= 0 || req.Seconds > maxExtendSec {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid seconds"})
+		return
+	}
+	rt, ok := s.controlRuntime(c, models.RoundRunning, models.RoundPaused)
+	if !ok {
+		return
+	}
+	next := rt.Extend(int64(req.Seconds) * 1000)
+	if err := s.applyRuntime(next, adminOperator(c), ""); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	if next.Round.Status == models.RoundRunning {
+		s.scheduleRoundEndLocked(next.Round.ID, next.Round.EndAtMS)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": next.Round.Status, "end_at": next.Round.EndAtMS})
+}
+
+// EndRoundEarly 立即结束游戏阶段，进入待开奖
+func (s *Server) EndRoundEarly(c *gin.Context) {
+	s.roundCtl.mu.Lock()
+	defer s.roundCtl.mu.Unlock()
+	rt, ok := s.controlRuntime(c, models.RoundRunning, models.RoundPaused)
+	if !ok {
+		return
+	}
+	now := time.Now().UnixMilli()
+	next := *rt
+	next.Round.Status = models.RoundReadyDraw
+	next.Round.EndAtMS = now
+	next.Round.PausedAtMS = 0
+	if err := s.applyRuntime(&next, adminOperator(c), "ended early"); err != nil {
+		c.JSON(transitionStatusCode(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.scheduleRoundEndLocked(next.Round.ID, 0)
+	c.JSON(http.StatusOK, gin.H{"status": models.RoundReadyDraw, "end_at": now})
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/game"
+	"hongbao/internal/models"
+)
+
+// applyRoundConfig 把配置写回轮次，roundConfig 的逆操作
+func applyRoundConfig(r *models.Round, cfg createRoundRequest) {
+	r.Title = cfg.Title
+	r.TotalPool = cfg.TotalPool
+	r.DurationSec = cfg.DurationSec
+	r.SliceMS = cfg.SliceMS
+	r.DropsPerSlice = cfg.DropsPerSlice
+	r.BombsPerSlice = cfg.BombsPerSlice
+	r.BigsPerSlice = cfg.BigsPerSlice
+	r.EmptyPerSlice = cfg.EmptyPerSlice
+	r.BigMultiplier = cfg.BigMultiplier
+	r.MaxSpeed = cfg.MaxSpeed
+	r.DropVisibleMS = cfg.DropVisibleMS
+	r.ScoreTotal = cfg.ScoreTotal
+	r.BombPenalty = cfg.BombPenalty
+	r.MinAward = cfg.MinAward
+	r.MaxAward = cfg.MaxAward
+	r.LuckyRatio = cfg.LuckyRatio
+	r.BaseRatio = cfg.BaseRatio
+	r.TailTopN = cfg.TailTopN
+	r.RankSegments = cfg.RankSegments
+	r.LeaderboardIntervalMS = cfg.LeaderboardIntervalMS
+	r.LeaderboardTopN = cfg.LeaderboardTopN
+	r.TeamMode = cfg.TeamMode
+	r.TeamCount = cfg.TeamCount
+	r.TeamRatio = cfg.TeamRatio
+	r.TeamTopN = cfg.TeamTopN
+	r.LateJoin = cfg.LateJoin
+	r.LateJoinSec = cfg.LateJoinSec
+}
+
+// PatchRound 修改 WAITING / LOCKED 轮次的配置，只覆盖请求中出现的字段，倒计时开始后不可修改
+func (s *Server) PatchRound(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if round.Status != models.RoundWaiting && round.Status != models.RoundLocked {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round already started"})
+		return
+	}
+	cfg, _, err := s.roundConfig(roundID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.ShouldBindJSON(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	if err := normalizeRoundConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 用与开始时相同的方式构建一次运行时，非法配置在编辑时即被拒绝
+	updated := *round
+	applyRoundConfig(&updated, *cfg)
+	probe := updated
+	probe.StartAtMS = time.Now().UnixMilli()
+	probe.EndAtMS = probe.StartAtMS + int64(probe.DurationSec)*1000
+	if _, err := game.BuildRoundRuntime(probe, s.Game.WindowMS()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%v: %v", errInvalidRoundConfig, err)})
+		return
+	}
+
+	res, err := s.DB.Exec(`UPDATE rounds SET title=?, total_pool=?, duration_sec=?, slice_ms=?, drops_per_slice=?, bombs_per_slice=?, bigs_per_slice=?, empty_per_slice=?, big_multiplier=?, max_speed=?, drop_visible_ms=?,
+		score_total=?, bomb_penalty=?, min_award=?, max_award=?, lucky_ratio=?, base_ratio=?, tail_top_n=?, rank_segments=?, leaderboard_interval_ms=?, leaderboard_top_n=?,
+		team_mode=?, team_count=?, team_ratio=?, team_top_n=?, late_join=?, late_join_sec=?, updated_at=NOW()
+		WHERE id=? AND status IN (?, ?)`,
+		cfg.Title, cfg.TotalPool, cfg.DurationSec, cfg.SliceMS, cfg.DropsPerSlice, cfg.BombsPerSlice, cfg.BigsPerSlice, cfg.EmptyPerSlice, cfg.BigMultiplier, cfg.MaxSpeed, cfg.DropVisibleMS,
+		cfg.ScoreTotal, cfg.BombPenalty, cfg.MinAward, cfg.MaxAward, cfg.LuckyRatio, cfg.BaseRatio, cfg.TailTopN, cfg.RankSegments, cfg.LeaderboardIntervalMS, cfg.LeaderboardTopN,
+		cfg.TeamMode, cfg.TeamCount, cfg.TeamRatio, cfg.TeamTopN, cfg.LateJoin, cfg.LateJoinSec,
+		roundID, models.RoundWaiting, models.RoundLocked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// 并发开始，或配置与原值完全相同
+		if latest, _ := s.getRoundByID(roundID); latest == nil || (latest.Status != models.RoundWaiting && latest.Status != models.RoundLocked) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "round already started"})
+			return
+		}
+	}
+	// 已锁定的轮次客户端停在等待页，推送新的标题与时长
+	if updated.Status == models.RoundLocked {
+		s.broadcastRoundState(updated)
+	}
+	c.JSON(http.StatusOK, gin.H{"id": roundID, "config": cfg})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/models"
+)
+
+// 定时器、自动流程等非管理员触发的迁移
+const actorSystem = "system"
+
+var (
+	errRoundStatusChanged = errors.New("round status changed")
+	errRoundActive        = errors.New("another round active")
+	errDrawInProgress     = errors.New("开奖正在进行中，请勿重复操作")
+	errInvalidRoundConfig = errors.New("invalid round config")
+)
+
+// sqlExecer 同时适配 *sql.DB 与 *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// transitionRound 按状态机校验 round.Status -> to，以当前状态做 CAS 更新并写入状态历史。
+// set/setArgs 为同一条 UPDATE 中需要一并写入的其他列（如 "seed=?, start_at_ms=?"）。
+// 成功后 round.Status 更新为 to。
+func (s *Server) transitionRound(q sqlExecer, round *models.Round, to models.RoundStatus, actor, reason string, set string, setArgs ...interface{}) error {
+	if err := models.CheckRoundTransition(*round, to); err != nil {
+		return err
+	}
+	query := `UPDATE rounds SET status=?, `
+	if set != "" {
+		query += set + `, `
+	}
+	query += `updated_at=NOW() WHERE id=? AND status=?`
+	args := make([]interface{}, 0, len(setArgs)+3)
+	args = append(args, to)
+	args = append(args, setArgs...)
+	args = append(args, round.ID, round.Status)
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errRoundStatusChanged
+	}
+	if err := recordRoundStatus(q, round.ID, round.Status, to, actor, reason); err != nil {
+		return err
+	}
+	round.Status = to
+	return nil
+}
+
+func recordRoundStatus(q sqlExecer, roundID int64, from, to models.RoundStatus, actor, reason string) error {
+	_, err := q.Exec(`INSERT INTO round_status_history (round_id, from_status, to_status, actor, reason, created_at) VALUES (?, ?, ?, ?, ?, NOW())`,
+		roundID, from, to, actor, trimAdjustReason(reason))
+	return err
+}
+
+// syncRuntimeStatus 同步内存中当前轮次的状态
+func (s *Server) syncRuntimeStatus(roundID int64, status models.RoundStatus) {
+	if rt := s.Game.GetCurrent(); rt != nil && rt.Round.ID == roundID {
+		rt.Round.Status = status
+		s.Game.SetCurrent(rt)
+	}
+}
+
+// transitionStatusCode 状态机拒绝、并发变更、已有进行中轮次、重复开奖或配置非法返回 400，其余为 500
+func transitionStatusCode(err error) int {
+	if errors.Is(err, models.ErrInvalidRoundTransition) || errors.Is(err, errRoundStatusChanged) ||
+		errors.Is(err, errRoundActive) || errors.Is(err, errDrawInProgress) || errors.Is(err, errInvalidRoundConfig) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GetRoundTimeline 轮次状态迁移时间线
+func (s *Server) GetRoundTimeline(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	rows, err := s.DB.Query(`SELECT id, round_id, from_status, to_status, actor, reason, created_at FROM round_status_history WHERE round_id = ? ORDER BY id ASC`, roundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+	items := make([]models.RoundStatusHistory, 0)
+	for rows.Next() {
+		var it models.RoundStatusHistory
+		var from, to string
+		if err := rows.Scan(&it.ID, &it.RoundID, &from, &to, &it.Actor, &it.Reason, &it.CreatedAt); err == nil {
+			it.FromStatus = models.RoundStatus(from)
+			it.ToStatus = models.RoundStatus(to)
+			items = append(items, it)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxTemplateNameLen = 64
+
+// roundTemplate 保存的轮次配置，config 为规范化后的创建参数
+type roundTemplate struct {
+	ID        int64              `json:"id"`
+	Name      string             `json:"name"`
+	Config    createRoundRequest `json:"config"`
+	Operator  string             `json:"operator"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type saveTemplateRequest struct {
+	Name    string              `json:"name"`
+	RoundID int64               `json:"round_id"` // 大于 0 时从该轮次读取配置
+	Config  *createRoundRequest `json:"config"`
+}
+
+type applyTemplateRequest struct {
+	Title     string `json:"title"`
+	TotalPool int64  `json:"total_pool"`
+}
+
+type cloneRoundRequest struct {
+	Whitelist *bool `json:"whitelist"` // 是否复制白名单，默认复制
+}
+
+// roundConfig 取出轮次的可配置字段
+func (s *Server) roundConfig(roundID int64) (*createRoundRequest, int64, error) {
+	r, err := s.getRoundByID(roundID)
+	if err != nil || r == nil {
+		return nil, 0, errors.New("round not found")
+	}
+	return &createRoundRequest{
+		Title:                 r.Title,
+		TotalPool:             r.TotalPool,
+		DurationSec:           r.DurationSec,
+		SliceMS:               r.SliceMS,
+		DropsPerSlice:         r.DropsPerSlice,
+		BombsPerSlice:         r.BombsPerSlice,
+		BigsPerSlice:          r.BigsPerSlice,
+		EmptyPerSlice:         r.EmptyPerSlice,
+		BigMultiplier:         r.BigMultiplier,
+		MaxSpeed:              r.MaxSpeed,
+		DropVisibleMS:         r.DropVisibleMS,
+		ScoreTotal:            r.ScoreTotal,
+		BombPenalty:           r.BombPenalty,
+		MinAward:              r.MinAward,
+		MaxAward:              r.MaxAward,
+		LuckyRatio:            r.LuckyRatio,
+		BaseRatio:             r.BaseRatio,
+		TailTopN:              r.TailTopN,
+		RankSegments:          r.RankSegments,
+		LeaderboardIntervalMS: r.LeaderboardIntervalMS,
+		LeaderboardTopN:       r.LeaderboardTopN,
+		TeamMode:              r.TeamMode,
+		TeamCount:             r.TeamCount,
+		TeamRatio:             r.TeamRatio,
+		TeamTopN:              r.TeamTopN,
+		LateJoin:              r.LateJoin,
+		LateJoinSec:           r.LateJoinSec,
+	}, r.TemplateID, nil
+}
+
+const roundTemplateColumns = `id, name, config, operator, created_at, updated_at`
+
+func scanRoundTemplate(row rowScanner) (*roundTemplate, error) {
+	var t roundTemplate
+	var raw []byte
+	if err := row.Scan(&t.ID, &t.Name, &raw, &t.Operator, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &t.Config); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *Server) getRoundTemplate(id int64) (*roundTemplate, error) {
+	return scanRoundTemplate(s.DB.QueryRow(`SELECT `+roundTemplateColumns+` FROM round_templates WHERE id = ?`, id))
+}
+
+// SaveRoundTemplate 保存模板（同名覆盖），配置来自请求或已有轮次
+func (s *Server) SaveRoundTemplate(c *gin.Context) {
+	var req saveTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > maxTemplateNameLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid name"})
+		return
+	}
+	cfg := req.Config
+	if req.RoundID > 0 {
+		var err error
+		if cfg, _, err = s.roundConfig(req.RoundID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if cfg == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "config or round_id required"})
+		return
+	}
+	if err := normalizeRoundConfig(cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	raw, _ := json.Marshal(cfg)
+	if _, err := s.DB.Exec(`INSERT INTO round_templates (name, config, operator, created_at, updated_at) VALUES (?, ?, ?, NOW(), NOW())
+		ON DUPLICATE KEY UPDATE config=VALUES(config), operator=VALUES(operator), updated_at=NOW()`, req.Name, raw, adminOperator(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	var id int64
+	_ = s.DB.QueryRow(`SELECT id FROM round_templates WHERE name = ?`, req.Name).Scan(&id)
+	c.JSON(http.StatusOK, gin.H{"id": id, "name": req.Name, "config": cfg})
+}
+
+// ListRoundTemplates 模板列表
+func (s *Server) ListRoundTemplates(c *gin.Context) {
+	rows, err := s.DB.Query(`SELECT ` + roundTemplateColumns + ` FROM round_templates ORDER BY name ASC`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+	items := make([]roundTemplate, 0)
+	for rows.Next() {
+		if t, err := scanRoundTemplate(rows); err == nil {
+			items = append(items, *t)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// DeleteRoundTemplate 删除模板，已创建的轮次保留 template_id
+func (s *Server) DeleteRoundTemplate(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := s.DB.Exec(`DELETE FROM round_templates WHERE id = ?`, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// ApplyRoundTemplate 按模板创建 WAITING 轮次，可覆盖标题与奖池
+func (s *Server) ApplyRoundTemplate(c *gin.Context) {
+	id, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req applyTemplateRequest
+	_ = c.ShouldBindJSON(&req)
+	tpl, err := s.getRoundTemplate(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if !s.checkNoPendingRound(c) {
+		return
+	}
+	cfg := tpl.Config
+	if title := strings.TrimSpace(req.Title); title != "" {
+		cfg.Title = title
+	}
+	if req.TotalPool > 0 {
+		cfg.TotalPool = req.TotalPool
+	}
+	if err := normalizeRoundConfig(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	roundID, err := s.insertRound(s.DB, cfg, tpl.ID, adminOperator(c), fmt.Sprintf("template #%d", tpl.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": roundID, "template_id": tpl.ID})
+}
+
+// CloneRound 以历史轮次的配置（可选白名单）创建新的 WAITING 轮次，沿用其模板来源
+func (s *Server) CloneRound(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req cloneRoundRequest
+	_ = c.ShouldBindJSON(&req)
+	cfg, templateID, err := s.roundConfig(roundID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkNoPendingRound(c) {
+		return
+	}
+	withWhitelist := req.Whitelist == nil || *req.Whitelist
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	newID, err := s.insertRound(tx, *cfg, templateID, adminOperator(c), fmt.Sprintf("clone of #%d", roundID))
+	if err != nil {
+		_ = tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	if withWhitelist {
+		if _, err := tx.Exec(`INSERT INTO round_whitelist (round_id, user_id, created_at) SELECT ?, user_id, NOW() FROM round_whitelist WHERE round_id = ?`, newID, roundID); err != nil {
+			_ = tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": newID, "source_id": roundID, "whitelist": withWhitelist})
+}
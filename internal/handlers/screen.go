@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hongbao/internal/models"
+)
+
+const (
+	screenEventLimit = 20
+	screenTopN       = 10
+)
+
+type screenEvent struct {
+	ID     int64  `json:"id"`
+	Kind   string `json:"kind"` // big / bomb
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Delta  int    `json:"delta"`
+	TS     int64  `json:"ts"`
+}
+
+// screenFeed 保存当前轮次最近的大红包/炸弹事件，供大屏展示
+type screenFeed struct {
+	mu      sync.Mutex
+	roundID int64
+	seq     int64
+	events  []screenEvent
+}
+
+func (f *screenFeed) add(roundID int64, ev screenEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.roundID != roundID {
+		f.roundID = roundID
+		f.events = f.events[:0]
+	}
+	f.seq++
+	ev.ID = f.seq
+	f.events = append(f.events, ev)
+	if len(f.events) > screenEventLimit {
+		f.events = append(f.events[:0], f.events[len(f.events)-screenEventLimit:]...)
+	}
+}
+
+func (f *screenFeed) recent(roundID int64) []screenEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.roundID != roundID {
+		return []screenEvent{}
+	}
+	out := make([]screenEvent, len(f.events))
+	copy(out, f.events)
+	return out
+}
+
+type screenResultItem struct {
+	Rank   int    `json:"rank"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Score  int    `json:"score"`
+	Amount int64  `json:"amount"`
+}
+
+// HandleScreenWS 大屏只读推送通道，使用 SCREEN_KEY 鉴权，不占用用户会话
+func (s *Server) HandleScreenWS(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimSpace(s.Cfg.ScreenKey)
+	if key == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	provided := strings.TrimSpace(r.URL.Query().Get("key"))
+	if provided == "" {
+		provided = strings.TrimSpace(r.Header.Get("X-Screen-Key"))
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !s.originAllowed(r) {
+		s.logRejectedOrigin(r, 0)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	client := NewWSClient(0, conn)
+	s.Hub.RegisterScreen(client)
+	defer func() {
+		s.Hub.UnregisterScreen(client)
+		_ = conn.Close()
+		close(client.SendCh)
+	}()
+
+	go client.WritePump()
+
+	client.Send(mustJSON(WSMessage{Type: "screen_state", Data: s.screenStatePayload()}))
+
+	// 读循环(仅用于保持连接)
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var inbound struct {
+			Type string `json:"type"`
+			Ts   int64  `json:"ts"`
+			Seq  int64  `json:"seq"`
+		}
+		if err := json.Unmarshal(msg, &inbound); err != nil {
+			continue
+		}
+		if inbound.Type == "ping" {
+			client.Send(mustJSON(WSMessage{
+				Type: "pong",
+				Data: map[string]interface{}{
+					"ts":          inbound.Ts,
+					"seq":         inbound.Seq,
+					"server_time": time.Now().UnixMilli(),
+				},
+			}))
+		}
+	}
+}
+
+func (s *Server) startScreenFeed() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.pushScreenState()
+			s.pushSpectatorState()
+		}
+	}()
+}
+
+func (s *Server) pushScreenState() {
+	if s.Hub.ScreenCount() == 0 {
+		return
+	}
+	s.Hub.BroadcastScreens(mustJSON(WSMessage{Type: "screen_state", Data: s.screenStatePayload()}))
+}
+
+// recordScreenEvent 记录大红包/炸弹命中事件，随下一次 screen_state 推送
+func (s *Server) recordScreenEvent(roundID int64, uid int64, delta int, isBomb bool, nowMS int64) {
+	kind := "big"
+	if isBomb {
+		kind = "bomb"
+	}
+	s.screen.add(roundID, screenEvent{Kind: kind, UserID: uid, Delta: delta, TS: nowMS})
+}
+
+func (s *Server) screenStatePayload() map[string]interface{} {
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+	resp := map[string]interface{}{
+		"server_time":  now,
+		"online_count": s.onlineCount(ctx, 0),
+		"round":        nil,
+	}
+	// 签到二维码在轮次开始前展示，不依赖运行时
+	if checkin := s.checkinPayload(ctx, now); checkin != nil {
+		resp["checkin"] = checkin
+	}
+	rt := s.Game.GetCurrent()
+	if rt == nil {
+		return resp
+	}
+	round := rt.Round
+	resp["round"] = round
+	resp["online_count"] = s.onlineCount(ctx, round.ID)
+	countdownMS, timeLeftMS := s.roundProgress(round, now)
+	resp["countdown_ms"] = countdownMS
+	resp["time_left_ms"] = timeLeftMS
+	qps, qps1s := s.calcQPS(round.ID, now)
+	resp["qps_avg"] = qps
+	resp["qps_1s"] = qps1s
+	scoreSum, _ := s.Redis.Get(ctx, scoreSumKey(round.ID)).Int64()
+	resp["score_sum"] = scoreSum
+	whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
+	resp["whitelist_count"] = whitelistCount
+	top, scoreUsers, err := s.topLeaderboard(ctx, round.ID, screenTopN)
+	if err != nil {
+		top = []leaderboardEntry{}
+	}
+	resp["top"] = top
+	resp["score_users"] = scoreUsers
+	if round.TeamMode != "" {
+		teams, err := s.topTeams(ctx, round.ID, teamLeaderboardTopN)
+		if err != nil {
+			teams = []teamEntry{}
+		}
+		resp["teams"] = teams
+	}
+
+	events := s.screen.recent(round.ID)
+	if len(events) > 0 {
+		ids := make([]int64, 0, len(events))
+		for _, ev := range events {
+			ids = append(ids, ev.UserID)
+		}
+		infoMap := s.getUsersByIDs(ids)
+		for i := range events {
+			events[i].Name = publicName(infoMap[events[i].UserID])
+		}
+	}
+	resp["events"] = events
+	return resp
+}
+
+// broadcastScreenResult 开奖完成后向大屏推送最终结果（按金额排序的前 N 名）
+func (s *Server) broadcastScreenResult(round models.Round, items []screenResultItem) {
+	if s.Hub.ScreenCount() == 0 {
+		return
+	}
+	sort.Slice(items, func(a, b int) bool {
+		if items[a].Amount != items[b].Amount {
+			return items[a].Amount > items[b].Amount
+		}
+		return items[a].Score > items[b].Score
+	})
+	winners := len(items)
+	if len(items) > screenTopN {
+		items = items[:screenTopN]
+	}
+	ids := make([]int64, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.UserID)
+	}
+	infoMap := s.getUsersByIDs(ids)
+	for i := range items {
+		items[i].Rank = i + 1
+		items[i].Name = publicName(infoMap[items[i].UserID])
+	}
+	s.Hub.BroadcastScreens(mustJSON(WSMessage{
+		Type: "screen_result",
+		Data: map[string]interface{}{
+			"round_id":   round.ID,
+			"title":      round.Title,
+			"total_pool": round.TotalPool,
+			"winners":    winners,
+			"items":      items,
+		},
+	}))
+}
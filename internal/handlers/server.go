@@ -27,8 +27,17 @@ type Server struct {
 	Hub             *Hub
 	Alipay          *payments.AlipayClient
 	withdrawEnabled atomic.Bool
+	danmakuEnabled  atomic.Bool
 	onlineTouch     sync.Map
 	qpsCounters     sync.Map
+	// 正在推送实时排行榜的轮次
+	leaderboardPushers sync.Map
+	screen             screenFeed
+	danmaku            danmakuBoard
+	slicePayloads      slicePayloadCache
+	broadcaster        roundBroadcaster
+	roundCtl           roundControl
+	clickLimit         clickLimiter
 }
 
 func NewServer(cfg config.Config, db *sql.DB, redis *redis.Client) *Server {
@@ -62,7 +71,12 @@ func NewServer(cfg config.Config, db *sql.DB, redis *redis.Client) *Server {
 	}
 	srv.withdrawEnabled.Store(cfg.WithdrawEnabled)
 	srv.loadWithdrawSwitch()
+	srv.loadDanmakuSettings()
 	srv.startQPSFlusher()
+	srv.startPresenceTrimmer()
+	srv.initClickLimiter()
+	srv.startScreenFeed()
+	srv.startAgendaScheduler()
 	return srv
 }
 
@@ -82,24 +96,6 @@ func (s *Server) SignAdminToken() (string, error) {
 	return auth.GenerateToken(s.JWTSecret, 0, "admin", true, sessionID, 8*time.Hour)
 }
 
-func (s *Server) MarkOnline(userID int64) {
-	if s.Redis == nil {
-		return
-	}
-	if userID <= 0 {
-		return
-	}
-	now := time.Now().UnixMilli()
-	if val, ok := s.onlineTouch.Load(userID); ok {
-		if last, ok := val.(int64); ok && now-last < 2000 {
-			return
-		}
-	}
-	s.onlineTouch.Store(userID, now)
-	_ = s.Redis.HSet(context.Background(), onlineUsersKey(), userID, now).Err()
-	_ = s.Redis.SAdd(context.Background(), onlineUserIDsKey(), userID).Err()
-}
-
 func (s *Server) isWhitelisted(roundID int64, userID int64) bool {
 	if s.Redis == nil {
 		return s.isWhitelistedDB(roundID, userID)
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"hongbao/internal/game"
+)
+
+// slicePayloadCache 缓存当前轮次每个用户的切片下发内容，运行时换代（新一轮、暂停恢复、延长）时整体失效
+type slicePayloadCache struct {
+	mu    sync.RWMutex
+	gen   game.RuntimeGeneration
+	users map[int64][]slicePayload
+}
+
+func (c *slicePayloadCache) get(rt *game.RoundRuntime, uid int64) ([]slicePayload, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.gen != rt.Generation() {
+		return nil, false
+	}
+	payloads, ok := c.users[uid]
+	return payloads, ok
+}
+
+func (c *slicePayloadCache) put(rt *game.RoundRuntime, uid int64, payloads []slicePayload) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.users == nil || c.gen != rt.Generation() {
+		c.gen = rt.Generation()
+		c.users = make(map[int64][]slicePayload)
+	}
+	c.users[uid] = payloads
+}
+
+func buildUserSlicePayloads(slices []game.SliceRuntime, revealSalt string, uid int64) []slicePayload {
+	payloads := make([]slicePayload, 0, len(slices))
+	for _, sl := range slices {
+		payloads = append(payloads, buildSlicePayload(sl.Manifest, revealSalt, uid))
+	}
+	return payloads
+}
+
+// userSlicePayloads 取用户切片下发内容，未命中（如倒计时后才加入白名单）时现算并写入缓存。
+// 只返回当前及之后的切片；返回的切片为共享只读数据，调用方不可修改。
+func (s *Server) userSlicePayloads(rt *game.RoundRuntime, uid int64) []slicePayload {
+	if rt == nil || len(rt.Slices) == 0 {
+		return []slicePayload{}
+	}
+	if payloads, ok := s.slicePayloads.get(rt, uid); ok {
+		return currentSlicePayloads(payloads, sliceCutoffMS(rt.Round))
+	}
+	payloads := buildUserSlicePayloads(rt.Slices, rt.RevealSalt, uid)
+	s.slicePayloads.put(rt, uid, payloads)
+	return currentSlicePayloads(payloads, sliceCutoffMS(rt.Round))
+}
+
+// precomputeSlicePayloads 进入 COUNTDOWN 时为白名单用户批量预计算切片下发内容，在后台执行；
+// 运行时已被替换（新一轮开始等）时提前结束，避免旧内容冲掉新缓存
+func (s *Server) precomputeSlicePayloads(rt *game.RoundRuntime) {
+	if rt == nil || s.Redis == nil {
+		return
+	}
+	members, err := s.Redis.SMembers(context.Background(), whitelistKey(rt.Round.ID)).Result()
+	if err != nil || len(members) == 0 {
+		return
+	}
+	jobs := make(chan int64)
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	if workers > len(members) {
+		workers = len(members)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for uid := range jobs {
+				if !s.runtimeCurrent(rt) {
+					continue
+				}
+				s.slicePayloads.put(rt, uid, buildUserSlicePayloads(rt.Slices, rt.RevealSalt, uid))
+			}
+		}()
+	}
+	for _, m := range members {
+		if uid, err := strconv.ParseInt(m, 10, 64); err == nil {
+			jobs <- uid
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// runtimeCurrent rt 是否仍是当前代次的运行时
+func (s *Server) runtimeCurrent(rt *game.RoundRuntime) bool {
+	return rt.SameGeneration(s.Game.GetCurrent())
+}
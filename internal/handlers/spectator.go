@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"hongbao/internal/game"
+	"hongbao/internal/models"
+)
+
+const (
+	// 观战动画使用的虚拟用户，真实用户 ID 从 1 开始，不会与任何玩家的掉落布局重合
+	spectatorUserID int64 = 0
+	// 观战榜单人数
+	spectatorTopN = 10
+)
+
+// spectatorSlices 观战动画切片：由轮次种子生成，所有观众共享一份；仅用于展示，点击一律按白名单拒绝
+func (s *Server) spectatorSlices(rt *game.RoundRuntime) []slicePayload {
+	return s.userSlicePayloads(rt, spectatorUserID)
+}
+
+// roundProgress 倒计时剩余与游戏剩余时间（毫秒），暂停时按暂停时刻计算
+func (s *Server) roundProgress(round models.Round, now int64) (int64, int64) {
+	var countdownMS, timeLeftMS int64
+	switch round.Status {
+	case models.RoundCountdown:
+		countdownMS = round.StartAtMS - now
+	case models.RoundRunning:
+		timeLeftMS = round.EndAtMS - now
+	case models.RoundPaused:
+		if round.PausedAtMS > 0 {
+			timeLeftMS = round.EndAtMS - round.PausedAtMS
+		}
+	}
+	return max(countdownMS, 0), max(timeLeftMS, 0)
+}
+
+// spectatorStatePayload 观战数据：进度、实时榜单与汇总，不含签到令牌等仅限现场的信息
+func (s *Server) spectatorStatePayload(ctx context.Context, round models.Round, now int64) map[string]interface{} {
+	countdownMS, timeLeftMS := s.roundProgress(round, now)
+	scoreSum, _ := s.Redis.Get(ctx, scoreSumKey(round.ID)).Int64()
+	whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
+	top, scoreUsers, err := s.topLeaderboard(ctx, round.ID, spectatorTopN)
+	if err != nil {
+		top = []leaderboardEntry{}
+	}
+	resp := map[string]interface{}{
+		"round_id":        round.ID,
+		"status":          round.Status,
+		"countdown_ms":    countdownMS,
+		"time_left_ms":    timeLeftMS,
+		"score_sum":       scoreSum,
+		"score_users":     scoreUsers,
+		"whitelist_count": whitelistCount,
+		"online_count":    s.onlineCount(ctx, round.ID),
+		"top":             top,
+		"server_time":     now,
+	}
+	if round.TeamMode != "" {
+		if teams, err := s.topTeams(ctx, round.ID, spectatorTopN); err == nil {
+			resp["teams"] = teams
+		}
+	}
+	return resp
+}
+
+// pushSpectatorState 每秒向在线的非白名单用户推送观战数据
+func (s *Server) pushSpectatorState() {
+	rt := s.Game.GetCurrent()
+	if rt == nil || s.Redis == nil || !roundInPlay(rt.Round.Status) {
+		return
+	}
+	userIDs := s.Hub.UserIDs()
+	if len(userIDs) == 0 {
+		return
+	}
+	ctx := context.Background()
+	eligibleMap := s.whitelistFlags(ctx, rt.Round.ID, userIDs)
+	var payload []byte
+	for _, uid := range userIDs {
+		if eligibleMap[uid] {
+			continue
+		}
+		if payload == nil {
+			payload = mustJSON(WSMessage{Type: "spectator_state", Data: s.spectatorStatePayload(ctx, rt.Round, time.Now().UnixMilli())})
+		}
+		s.Hub.SendToUser(uid, payload)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"hongbao/internal/auth"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// GameEvents SSE 推送通道，供无法建立 WebSocket 的网络使用。
+// 订阅者以无连接的 WSClient 注册到 Hub，因此与 WS 收到相同的广播；点击仍走 /api/game/click。
+func (s *Server) GameEvents(c *gin.Context) {
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming unsupported"})
+		return
+	}
+	claims := &auth.Claims{
+		UserID:    c.GetInt64("uid"),
+		Phone:     c.GetString("phone"),
+		SessionID: c.GetString("sid"),
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	client := NewWSClient(claims.UserID, nil)
+	s.Hub.Register(client)
+	s.MarkOnline(claims.UserID)
+	defer s.Hub.Unregister(client)
+
+	writeEvent := func(payload []byte) bool {
+		if _, err := c.Writer.Write([]byte("data: ")); err != nil {
+			return false
+		}
+		if _, err := c.Writer.Write(payload); err != nil {
+			return false
+		}
+		if _, err := c.Writer.Write([]byte("\n\n")); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// 与 WS 一致：先发 hello + 当前轮次状态
+	if !writeEvent(mustJSON(WSMessage{Type: "hello", Data: s.helloPayload(claims)})) {
+		return
+	}
+	if state := s.initialRoundState(claims.UserID); state != nil {
+		if !writeEvent(mustJSON(WSMessage{Type: "round_state", Data: state})) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-client.SendCh:
+			if !writeEvent(msg) {
+				return
+			}
+		case <-heartbeat.C:
+			s.MarkOnline(claims.UserID)
+			if _, err := c.Writer.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
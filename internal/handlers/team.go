@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+const (
+	teamModeDepartment = "DEPARTMENT"
+	teamModeRandom     = "RANDOM"
+	defaultTeamCount   = 4
+	maxTeamCount       = 100
+	// 部门为空的用户归入该队
+	unassignedTeam = "未分组"
+	// 实时推送的队伍数
+	teamLeaderboardTopN = 20
+)
+
+type teamEntry struct {
+	Rank  int    `json:"rank"`
+	Team  string `json:"team"`
+	Score int    `json:"score"`
+}
+
+type roundTeamItem struct {
+	Rank       int    `json:"rank"`
+	Team       string `json:"team"`
+	Score      int    `json:"score"`
+	Members    int    `json:"members"`
+	TeamAmount int64  `json:"team_amount"`
+	Amount     int64  `json:"amount"`
+}
+
+// normalizeTeamConfig 校验团队赛配置，个人赛时清零其余字段
+func normalizeTeamConfig(req *createRoundRequest) error {
+	req.TeamMode = strings.ToUpper(strings.TrimSpace(req.TeamMode))
+	switch req.TeamMode {
+	case "":
+		req.TeamCount, req.TeamRatio, req.TeamTopN = 0, 0, 0
+		return nil
+	case teamModeDepartment:
+		req.TeamCount = 0
+	case teamModeRandom:
+		if req.TeamCount <= 0 {
+			req.TeamCount = defaultTeamCount
+		}
+		if req.TeamCount < 2 || req.TeamCount > maxTeamCount {
+			return fmt.Errorf("team_count must be between 2 and %d", maxTeamCount)
+		}
+	default:
+		return errors.New("invalid team_mode")
+	}
+	if req.TeamRatio < 0 || req.TeamRatio > 100 {
+		return errors.New("team_ratio must be between 0 and 100")
+	}
+	if req.TeamTopN <= 0 {
+		req.TeamTopN = 1
+	}
+	return nil
+}
+
+func randomTeamName(i int) string {
+	return fmt.Sprintf("第%d队", i+1)
+}
+
+// assignRoundTeams 为尚未分队的用户分队：按部门，或随机分到人数最少的队伍；已分队的用户保持不变
+func (s *Server) assignRoundTeams(ctx context.Context, round *models.Round, userIDs []int64) {
+	if round.TeamMode == "" || s.Redis == nil || len(userIDs) == 0 {
+		return
+	}
+	key := teamsKey(round.ID)
+	fields := make([]string, len(userIDs))
+	for i, uid := range userIDs {
+		fields[i] = scoreMember(uid)
+	}
+	existing, err := s.Redis.HMGet(ctx, key, fields...).Result()
+	if err != nil {
+		return
+	}
+	missing := make([]int64, 0)
+	for i, v := range existing {
+		if v == nil {
+			missing = append(missing, userIDs[i])
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	assigned := make(map[string]interface{}, len(missing))
+	teams := make(map[string]bool)
+	switch round.TeamMode {
+	case teamModeDepartment:
+		infoMap := s.getUsersByIDs(missing)
+		for _, uid := range missing {
+			team := infoMap[uid].Department
+			if team == "" {
+				team = unassignedTeam
+			}
+			assigned[scoreMember(uid)] = team
+			teams[team] = true
+		}
+	case teamModeRandom:
+		sizes := make([]int, round.TeamCount)
+		index := make(map[string]int, round.TeamCount)
+		for i := range sizes {
+			index[randomTeamName(i)] = i
+		}
+		if vals, err := s.Redis.HVals(ctx, key).Result(); err == nil {
+			for _, v := range vals {
+				if i, ok := index[v]; ok {
+					sizes[i]++
+				}
+			}
+		}
+		mathrand.Shuffle(len(missing), func(i, j int) { missing[i], missing[j] = missing[j], missing[i] })
+		for _, uid := range missing {
+			best := 0
+			for i := range sizes {
+				if sizes[i] < sizes[best] {
+					best = i
+				}
+			}
+			sizes[best]++
+			team := randomTeamName(best)
+			assigned[scoreMember(uid)] = team
+			teams[team] = true
+		}
+	}
+
+	// 队伍先以 0 分入榜，开局即可看到全部队伍
+	zs := make([]redis.Z, 0, len(teams))
+	for team := range teams {
+		zs = append(zs, redis.Z{Member: team, Score: 0})
+	}
+	ttl := s.roundKeyTTL(round.ID)
+	pipe := s.Redis.Pipeline()
+	pipe.HSet(ctx, key, assigned)
+	pipe.ZAddNX(ctx, teamScoreKey(round.ID), zs...)
+	pipe.Expire(ctx, key, ttl)
+	pipe.Expire(ctx, teamScoreKey(round.ID), ttl)
+	_, _ = pipe.Exec(ctx)
+}
+
+// roundTeams 轮次的用户分队
+func (s *Server) roundTeams(ctx context.Context, roundID int64) map[int64]string {
+	out := make(map[int64]string)
+	if s.Redis == nil {
+		return out
+	}
+	all, err := s.Redis.HGetAll(ctx, teamsKey(roundID)).Result()
+	if err != nil {
+		return out
+	}
+	for member, team := range all {
+		if uid := parseUserID(member); uid > 0 {
+			out[uid] = team
+		}
+	}
+	return out
+}
+
+// topTeams 队伍排行，n <= 0 时返回全部
+func (s *Server) topTeams(ctx context.Context, roundID int64, n int) ([]teamEntry, error) {
+	stop := int64(-1)
+	if n > 0 {
+		stop = int64(n - 1)
+	}
+	items, err := s.Redis.ZRevRangeWithScores(ctx, teamScoreKey(roundID), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]teamEntry, 0, len(items))
+	for i, item := range items {
+		team, _ := item.Member.(string)
+		entries = append(entries, teamEntry{Rank: i + 1, Team: team, Score: int(item.Score)})
+	}
+	return entries, nil
+}
+
+// pushTeamLeaderboard 推送队伍排行，并返回每支队伍的名次供个人排名消息使用
+func (s *Server) pushTeamLeaderboard(ctx context.Context, round models.Round, now int64) map[string]teamEntry {
+	all, err := s.topTeams(ctx, round.ID, 0)
+	if err != nil {
+		return nil
+	}
+	top := all
+	if len(top) > teamLeaderboardTopN {
+		top = top[:teamLeaderboardTopN]
+	}
+	s.Hub.Broadcast(mustJSON(WSMessage{
+		Type: "team_leaderboard",
+		Data: map[string]interface{}{
+			"round_id":    round.ID,
+			"team_mode":   round.TeamMode,
+			"items":       top,
+			"total_teams": len(all),
+			"server_time": now,
+		},
+	}))
+	byTeam := make(map[string]teamEntry, len(all))
+	for _, e := range all {
+		byTeam[e.Team] = e
+	}
+	return byTeam
+}
+
+// splitByWeight 按权重用最大余数法拆分 total，权重之和为 0 时全部为 0
+func splitByWeight(total int64, weights []float64) []int64 {
+	out := make([]int64, len(weights))
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if total <= 0 || sum <= 0 {
+		return out
+	}
+	fracs := make([]float64, len(weights))
+	allocated := int64(0)
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		out[i] = int64(exact)
+		fracs[i] = exact - float64(out[i])
+		allocated += out[i]
+	}
+	idxs := make([]int, len(weights))
+	for i := range idxs {
+		idxs[i] = i
+	}
+	sort.Slice(idxs, func(a, b int) bool { return fracs[idxs[a]] > fracs[idxs[b]] })
+	for i := 0; allocated < total && i < len(idxs); i++ {
+		if weights[idxs[i]] <= 0 {
+			continue
+		}
+		out[idxs[i]]++
+		allocated++
+	}
+	return out
+}
+
+// allocateTeamPool 团队奖池由前 topN 支队伍按队伍总分瓜分，队内再按个人分数瓜分；
+// teams、scores 与开奖明细同序，返回每人的团队奖金与实际发出的总额（没有得分队伍时为 0）
+func allocateTeamPool(pool int64, topN int, teams []string, scores []int) ([]int64, int64) {
+	amounts := make([]int64, len(teams))
+	teamScores := make(map[string]int)
+	for i, team := range teams {
+		if team != "" && scores[i] > 0 {
+			teamScores[team] += scores[i]
+		}
+	}
+	ranked := make([]string, 0, len(teamScores))
+	for team := range teamScores {
+		ranked = append(ranked, team)
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if teamScores[ranked[a]] != teamScores[ranked[b]] {
+			return teamScores[ranked[a]] > teamScores[ranked[b]]
+		}
+		return ranked[a] < ranked[b]
+	})
+	if len(ranked) > topN {
+		ranked = ranked[:topN]
+	}
+	if pool <= 0 || len(ranked) == 0 {
+		return amounts, 0
+	}
+	teamWeights := make([]float64, len(ranked))
+	for i, team := range ranked {
+		teamWeights[i] = float64(teamScores[team])
+	}
+	shares := splitByWeight(pool, teamWeights)
+	for t, team := range ranked {
+		members := make([]int, 0)
+		weights := make([]float64, 0)
+		for i := range teams {
+			if teams[i] == team && scores[i] > 0 {
+				members = append(members, i)
+				weights = append(weights, float64(scores[i]))
+			}
+		}
+		for j, amount := range splitByWeight(shares[t], weights) {
+			amounts[members[j]] = amount
+		}
+	}
+	return amounts, pool
+}
+
+// GetRoundTeams 队伍排行：实时总分与人数，开奖后附带团队奖金与总金额
+func (s *Server) GetRoundTeams(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	items := make([]roundTeamItem, 0)
+	if round.TeamMode == "" {
+		c.JSON(http.StatusOK, gin.H{"team_mode": "", "items": items})
+		return
+	}
+
+	byTeam := make(map[string]*roundTeamItem)
+	get := func(team string) *roundTeamItem {
+		if it, ok := byTeam[team]; ok {
+			return it
+		}
+		it := &roundTeamItem{Team: team}
+		byTeam[team] = it
+		return it
+	}
+	ctx := context.Background()
+	live := false
+	if s.Redis != nil {
+		if entries, err := s.topTeams(ctx, roundID, 0); err == nil && len(entries) > 0 {
+			live = true
+			for _, e := range entries {
+				get(e.Team).Score = e.Score
+			}
+			for _, team := range s.roundTeams(ctx, roundID) {
+				get(team).Members++
+			}
+		}
+	}
+	rows, err := s.DB.Query(`SELECT ad.team, COUNT(1), COALESCE(SUM(ad.score), 0), COALESCE(SUM(ad.team_amount), 0), COALESCE(SUM(ad.amount), 0)
+		FROM award_details ad JOIN award_batches ab ON ad.batch_id = ab.id
+		WHERE ab.round_id = ? AND ab.status <> 'VOID' AND ad.team <> '' GROUP BY ad.team`, roundID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var team string
+		var members, score int
+		var teamAmount, amount int64
+		if err := rows.Scan(&team, &members, &score, &teamAmount, &amount); err != nil {
+			continue
+		}
+		it := get(team)
+		it.TeamAmount = teamAmount
+		it.Amount = amount
+		// Redis 已过期时以开奖明细为准（仅含得分用户）
+		if !live {
+			it.Score = score
+			it.Members = members
+		}
+	}
+	for _, it := range byTeam {
+		items = append(items, *it)
+	}
+	sort.Slice(items, func(a, b int) bool {
+		if items[a].Score != items[b].Score {
+			return items[a].Score > items[b].Score
+		}
+		return items[a].Team < items[b].Team
+	})
+	for i := range items {
+		items[i].Rank = i + 1
+	}
+	c.JSON(http.StatusOK, gin.H{"team_mode": round.TeamMode, "team_ratio": round.TeamRatio, "team_top_n": round.TeamTopN, "items": items})
+}
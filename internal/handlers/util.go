@@ -39,12 +39,29 @@ func scoreMember(userID int64) string {
 	return "u:" + strconv.FormatInt(userID, 10)
 }
 
+// teamsKey 团队赛用户所属队伍，field 为 scoreMember
+func teamsKey(roundID int64) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":teams"
+}
+
+// teamScoreKey 团队赛队伍总分
+func teamScoreKey(roundID int64) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":team_scores"
+}
+
+// roundJoinedKey 用户首次在场时间（hash: u:{uid} -> 毫秒时间戳）
+func roundJoinedKey(roundID int64) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":joined"
+}
+
+// onlineUsersKey 全站在线有序集合，score 为最后活跃毫秒时间戳
 func onlineUsersKey() string {
-	return "online:users"
+	return "online:last_seen"
 }
 
-func onlineUserIDsKey() string {
-	return "online:user:ids"
+// roundPresentKey 轮次在场且在白名单内的用户，score 同上
+func roundPresentKey(roundID int64) string {
+	return "round:" + strconv.FormatInt(roundID, 10) + ":present"
 }
 
 func sessionKey(userID int64) string {
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"hongbao/internal/models"
+)
+
+const (
+	// 多行 INSERT 每批的行数
+	whitelistBatchSize = 500
+	// CSV 导入上限
+	maxWhitelistImportBytes = 5 << 20
+	maxWhitelistImportRows  = 20000
+	maxDepartmentLen        = 64
+	// 导入结果中最多返回的跳过行
+	maxImportSkipped = 50
+)
+
+// removeScoreLua 移除用户分数并同步扣减总分与队伍分
+var removeScoreLua = redis.NewScript(`
+local score = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1]) or '0')
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 and score ~= 0 then
+  redis.call('INCRBY', KEYS[2], -score)
+  local team = redis.call('HGET', KEYS[3], ARGV[1])
+  if team then
+    redis.call('ZINCRBY', KEYS[4], -score, team)
+  end
+end
+return score
+`)
+
+type whitelistEntry struct {
+	Phone      string
+	Nickname   string
+	Department string
+}
+
+type whitelistItem struct {
+	UserID     int64     `json:"user_id"`
+	Phone      string    `json:"phone"`
+	Nickname   string    `json:"nickname"`
+	Name       string    `json:"name"`
+	Department string    `json:"department"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type importSkip struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+type removeWhitelistRequest struct {
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// validPhone 手机号只允许数字与开头的 +
+func validPhone(phone string) bool {
+	if len(phone) < 5 || len(phone) > 20 {
+		return false
+	}
+	for i, r := range phone {
+		if r == '+' && i == 0 {
+			continue
+		}
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func sqlPlaceholders(n int, group string) string {
+	return strings.TrimRight(strings.Repeat(group+",", n), ",")
+}
+
+// upsertWhitelistUsers 批量建档，昵称只补空值，部门以导入为准，返回与 entries 同序的用户 ID
+func (s *Server) upsertWhitelistUsers(entries []whitelistEntry) ([]int64, error) {
+	ids := make([]int64, 0, len(entries))
+	for start := 0; start < len(entries); start += whitelistBatchSize {
+		batch := entries[start:min(start+whitelistBatchSize, len(entries))]
+		args := make([]interface{}, 0, len(batch)*4)
+		phones := make([]interface{}, 0, len(batch))
+		for _, e := range batch {
+			args = append(args, e.Phone, e.Nickname, boolToInt(s.Cfg.AdminPhones[e.Phone]), e.Department)
+			phones = append(phones, e.Phone)
+		}
+		_, err := s.DB.Exec(`INSERT INTO users (phone, nickname, is_admin, department, avatar_url, created_at, updated_at) VALUES `+
+			sqlPlaceholders(len(batch), "(?, ?, ?, ?, '', NOW(), NOW())")+`
+			ON DUPLICATE KEY UPDATE nickname = IF(nickname = '', VALUES(nickname), nickname),
+			department = IF(VALUES(department) = '', department, VALUES(department)), updated_at = NOW()`, args...)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := s.DB.Query(`SELECT id, phone FROM users WHERE phone IN (`+sqlPlaceholders(len(phones), "?")+`)`, phones...)
+		if err != nil {
+			return nil, err
+		}
+		byPhone := make(map[string]int64, len(batch))
+		for rows.Next() {
+			var id int64
+			var phone string
+			if err := rows.Scan(&id, &phone); err == nil {
+				byPhone[phone] = id
+			}
+		}
+		_ = rows.Close()
+		for _, e := range batch {
+			if id, ok := byPhone[e.Phone]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// addRoundWhitelist 批量写入白名单，已锁定的轮次同步到 Redis，返回新增条数
+func (s *Server) addRoundWhitelist(round *models.Round, userIDs []int64) (int64, error) {
+	var added int64
+	for start := 0; start < len(userIDs); start += whitelistBatchSize {
+		batch := userIDs[start:min(start+whitelistBatchSize, len(userIDs))]
+		args := make([]interface{}, 0, len(batch)*2)
+		for _, uid := range batch {
+			args = append(args, round.ID, uid)
+		}
+		res, err := s.DB.Exec(`INSERT IGNORE INTO round_whitelist (round_id, user_id, created_at) VALUES `+
+			sqlPlaceholders(len(batch), "(?, ?, NOW())"), args...)
+		if err != nil {
+			return added, err
+		}
+		n, _ := res.RowsAffected()
+		added += n
+	}
+	// 如果轮次已锁定或正在进行，立即同步到 Redis 白名单
+	if round.Status != models.RoundWaiting && s.Redis != nil && len(userIDs) > 0 {
+		ctx := context.Background()
+		members := make([]interface{}, len(userIDs))
+		for i, uid := range userIDs {
+			members[i] = uid
+		}
+		_ = s.Redis.SAdd(ctx, whitelistKey(round.ID), members...).Err()
+		s.seedRoundPresence(ctx, round.ID)
+		// 开始后补充的用户立即分队
+		if round.Status == models.RoundCountdown || round.Status == models.RoundRunning || round.Status == models.RoundPaused {
+			s.assignRoundTeams(ctx, round, userIDs)
+		}
+	}
+	return added, nil
+}
+
+// whitelistRemovable 开奖流程开始后改用排除，不再移出白名单
+func whitelistRemovable(status models.RoundStatus) bool {
+	switch status {
+	case models.RoundWaiting, models.RoundLocked, models.RoundCountdown, models.RoundRunning, models.RoundPaused:
+		return true
+	}
+	return false
+}
+
+// removeRoundWhitelist 移出白名单；已锁定的轮次同步 Redis、清除已得分数并通知被移出的用户
+func (s *Server) removeRoundWhitelist(round *models.Round, userIDs []int64) (int64, error) {
+	args := make([]interface{}, 0, len(userIDs)+1)
+	args = append(args, round.ID)
+	for _, uid := range userIDs {
+		args = append(args, uid)
+	}
+	res, err := s.DB.Exec(`DELETE FROM round_whitelist WHERE round_id = ? AND user_id IN (`+sqlPlaceholders(len(userIDs), "?")+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := res.RowsAffected()
+	if round.Status == models.RoundWaiting || s.Redis == nil {
+		return removed, nil
+	}
+
+	ctx := context.Background()
+	members := make([]interface{}, len(userIDs))
+	for i, uid := range userIDs {
+		members[i] = uid
+	}
+	_ = s.Redis.SRem(ctx, whitelistKey(round.ID), members...).Err()
+	_ = s.Redis.ZRem(ctx, roundPresentKey(round.ID), members...).Err()
+	if round.Status != models.RoundLocked {
+		fields := make([]string, len(userIDs))
+		for i, uid := range userIDs {
+			fields[i] = scoreMember(uid)
+		}
+		_ = s.Redis.HDel(ctx, roundJoinedKey(round.ID), fields...).Err()
+		for _, uid := range userIDs {
+			_ = removeScoreLua.Run(ctx, s.Redis, []string{scoreZSetKey(round.ID), scoreSumKey(round.ID), teamsKey(round.ID), teamScoreKey(round.ID)}, scoreMember(uid)).Err()
+		}
+	}
+
+	// 被移出的用户转为观战
+	ineligible := false
+	rt := s.Game.GetCurrent()
+	if rt != nil && rt.Round.ID != round.ID {
+		rt = nil
+	}
+	whitelistCount, _ := s.Redis.SCard(ctx, whitelistKey(round.ID)).Result()
+	notice := mustJSON(WSMessage{Type: "whitelist_removed", Data: map[string]interface{}{"round_id": round.ID}})
+	state := mustJSON(WSMessage{
+		Type: "round_state",
+		Data: s.roundStatePayload(*round, rt, &ineligible, s.onlineCount(ctx, round.ID), int(whitelistCount), 0),
+	})
+	for _, uid := range userIDs {
+		s.Hub.SendToUser(uid, notice)
+		s.Hub.SendToUser(uid, state)
+	}
+	s.pushScreenState()
+	return removed, nil
+}
+
+// ListWhitelist 白名单分页列表，q 按手机号、昵称、姓名、部门模糊匹配或按用户 ID 精确匹配
+func (s *Server) ListWhitelist(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	offset := 0
+	if v := c.Query("offset"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	where := ` WHERE w.round_id = ?`
+	args := []interface{}{roundID}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + q + "%"
+		uid, err := strconv.ParseInt(q, 10, 64)
+		if err != nil {
+			uid = -1
+		}
+		where += ` AND (u.phone LIKE ? OR u.nickname LIKE ? OR e.name LIKE ? OR u.department LIKE ? OR w.user_id = ?)`
+		args = append(args, like, like, like, like, uid)
+	}
+	from := ` FROM round_whitelist w LEFT JOIN users u ON u.id = w.user_id LEFT JOIN roster_employees e ON e.user_id = w.user_id`
+
+	var total int
+	if err := s.DB.QueryRow(`SELECT COUNT(1)`+from+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	rows, err := s.DB.Query(`SELECT w.user_id, COALESCE(u.phone, ''), COALESCE(u.nickname, ''), COALESCE(e.name, ''), COALESCE(u.department, ''), w.created_at`+
+		from+where+` ORDER BY w.created_at DESC, w.user_id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	defer rows.Close()
+	items := make([]whitelistItem, 0)
+	for rows.Next() {
+		var it whitelistItem
+		if err := rows.Scan(&it.UserID, &it.Phone, &it.Nickname, &it.Name, &it.Department, &it.CreatedAt); err == nil {
+			items = append(items, it)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "total": total, "limit": limit, "offset": offset})
+}
+
+// RemoveWhitelist 批量移出白名单
+func (s *Server) RemoveWhitelist(c *gin.Context) {
+	var req removeWhitelistRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.UserIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids required"})
+		return
+	}
+	s.removeWhitelistUsers(c, req.UserIDs)
+}
+
+// RemoveWhitelistUser 移出单个用户
+func (s *Server) RemoveWhitelistUser(c *gin.Context) {
+	uid, err := parseIDParam(c, "uid")
+	if err != nil || uid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid uid"})
+		return
+	}
+	s.removeWhitelistUsers(c, []int64{uid})
+}
+
+func (s *Server) removeWhitelistUsers(c *gin.Context, userIDs []int64) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	if !whitelistRemovable(round.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "round already ended, use exclusions"})
+		return
+	}
+	removed, err := s.removeRoundWhitelist(round, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "removed": removed})
+}
+
+// ImportWhitelistCSV 从 CSV（phone, nickname, department）导入白名单，可带表头；
+// 支持 multipart 的 file 字段或直接以请求体上传
+func (s *Server) ImportWhitelistCSV(c *gin.Context) {
+	roundID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	round, err := s.getRoundByID(roundID)
+	if err != nil || round == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "round not found"})
+		return
+	}
+	data, err := readUpload(c, maxWhitelistImportBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, skipped, err := parseWhitelistCSV(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty whitelist", "skipped": skipped})
+		return
+	}
+	userIDs, err := s.upsertWhitelistUsers(entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user error"})
+		return
+	}
+	added, err := s.addRoundWhitelist(round, userIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "count": len(userIDs), "added": added, "skipped": skipped})
+}
+
+// readUpload 读取 multipart 的 file 字段，没有时读取整个请求体
+func readUpload(c *gin.Context, maxBytes int64) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("file required")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, errors.New("file error")
+		}
+		defer f.Close()
+		r = f
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.New("file too large")
+	}
+	return bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), nil
+}
+
+// parseWhitelistCSV 解析并去重（同一手机号以最后一行为准），非法行记入 skipped
+func parseWhitelistCSV(data []byte) ([]whitelistEntry, []importSkip, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	entries := make([]whitelistEntry, 0)
+	index := make(map[string]int)
+	skipped := make([]importSkip, 0)
+	skip := func(line int, reason string) {
+		if len(skipped) < maxImportSkipped {
+			skipped = append(skipped, importSkip{Line: line, Reason: reason})
+		}
+	}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("csv error at line %d", line)
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		phone := strings.TrimSpace(record[0])
+		if !validPhone(phone) {
+			// 首行为表头
+			if line > 1 {
+				skip(line, "invalid phone")
+			}
+			continue
+		}
+		e := whitelistEntry{Phone: phone}
+		if len(record) > 1 {
+			nickname, err := normalizeNickname(record[1])
+			if err != nil {
+				skip(line, err.Error())
+				continue
+			}
+			e.Nickname = nickname
+		}
+		if len(record) > 2 {
+			e.Department = strings.TrimSpace(record[2])
+			if len([]rune(e.Department)) > maxDepartmentLen {
+				skip(line, "department too long")
+				continue
+			}
+		}
+		if i, ok := index[phone]; ok {
+			entries[i] = e
+			continue
+		}
+		if len(entries) >= maxWhitelistImportRows {
+			return nil, nil, fmt.Errorf("too many rows (max %d)", maxWhitelistImportRows)
+		}
+		index[phone] = len(entries)
+		entries = append(entries, e)
+	}
+	return entries, skipped, nil
+}
@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -14,6 +13,7 @@ import (
 	"hongbao/internal/models"
 )
 
+// 来源由各 handler 通过 originAllowed 校验（需记录被拒用户），升级时不再重复检查
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
@@ -23,7 +23,8 @@ type WSMessage struct {
 	Data interface{} `json:"data"`
 }
 
-func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
+// HandleWS remoteIP 由路由层按可信代理解析（c.ClientIP()），与 HTTP 点击限速口径一致
+func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request, remoteIP string) {
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		token = getBearerToken(r)
@@ -37,6 +38,11 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if !s.originAllowed(r) {
+		s.logRejectedOrigin(r, claims.UserID)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
@@ -54,37 +60,22 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 
 	// 发送 hello + 当前轮次状态
 	_ = conn.SetReadDeadline(time.Time{})
-	signKey := ""
-	if key, ok := s.gameSignKey(claims.SessionID); ok {
-		signKey = hex.EncodeToString(key)
-	}
 	_ = conn.WriteMessage(websocket.TextMessage, mustJSON(WSMessage{
 		Type: "hello",
-		Data: map[string]interface{}{
-			"server_time": time.Now().UnixMilli(),
-			"sign_key":    signKey,
-			"user": map[string]interface{}{
-				"id":    claims.UserID,
-				"phone": claims.Phone,
-			},
-		},
+		Data: s.helloPayload(claims),
 	}))
-
-	current := s.Game.GetCurrent()
-	if current != nil {
-		eligible := s.isWhitelisted(current.Round.ID, claims.UserID)
-		payloadRound := current.Round
-		if !eligible && payloadRound.Status != models.RoundWaiting && payloadRound.Status != models.RoundLocked {
-			payloadRound.Status = models.RoundLocked
-		}
-		whitelistCount, _ := s.Redis.SCard(context.Background(), whitelistKey(current.Round.ID)).Result()
-		onlineCount := len(s.getActiveOnlineUserIDs(context.Background()))
+	if state := s.initialRoundState(claims.UserID); state != nil {
 		_ = conn.WriteMessage(websocket.TextMessage, mustJSON(WSMessage{
 			Type: "round_state",
-			Data: roundStatePayload(payloadRound, current.Slices, current.RevealSalt, &eligible, onlineCount, int(whitelistCount), claims.UserID),
+			Data: state,
 		}))
 	}
 
+	conn.SetPongHandler(func(appData string) error {
+		client.clock.observePong(appData, time.Now().UnixMilli(), int64(s.Cfg.ClickMaxRTTMS))
+		return nil
+	})
+
 	// 读循环(仅用于保持连接)
 	for {
 		_, msg, err := conn.ReadMessage()
@@ -103,14 +94,29 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 		switch inbound.Type {
 		case "ping":
 			s.MarkOnline(claims.UserID)
+			now := time.Now().UnixMilli()
+			// ts 为客户端本地时钟，用于估计时钟偏移；RTT 由服务端 ping/pong 计时，不采信客户端上报
+			client.clock.observe(inbound.Ts, now)
 			client.Send(mustJSON(WSMessage{
 				Type: "pong",
 				Data: map[string]interface{}{
 					"ts":          inbound.Ts,
 					"seq":         inbound.Seq,
-					"server_time": time.Now().UnixMilli(),
+					"server_time": now,
 				},
 			}))
+		case "danmaku":
+			var req struct {
+				Text string `json:"text"`
+			}
+			_ = json.Unmarshal(inbound.Data, &req)
+			resp := map[string]interface{}{"s": inbound.Seq}
+			if msg, err := s.sendDanmaku(context.Background(), claims.UserID, req.Text); err != nil {
+				resp["e"] = err.Error()
+			} else {
+				resp["id"] = msg.ID
+			}
+			client.Send(mustJSON(WSMessage{Type: "danmaku_result", Data: resp}))
 		case "click", "c":
 			var req clickRequest
 			if len(inbound.Data) > 0 {
@@ -118,6 +124,7 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 					R int64  `json:"r"`
 					D int    `json:"d"`
 					T int64  `json:"t"`
+					N int64  `json:"n"`
 					S string `json:"s"`
 					Seq int64 `json:"seq"`
 				}
@@ -125,6 +132,7 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 					req.RoundID = short.R
 					req.DropID = short.D
 					req.ClientTS = short.T
+					req.Nonce = short.N
 					req.Sign = short.S
 					if inbound.Seq == 0 && short.Seq > 0 {
 						inbound.Seq = short.Seq
@@ -149,7 +157,23 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			s.MarkOnline(claims.UserID)
-			if !s.verifySign(claims.UserID, claims.SessionID, req.RoundID, req.DropID, req.ClientTS, req.Sign) {
+			if err := s.allowClick(context.Background(), claims.UserID, remoteIP); err != nil {
+				respType := "click_result"
+				if inbound.Type == "c" {
+					respType = "cr"
+				}
+				client.Send(mustJSON(WSMessage{
+					Type: respType,
+					Data: map[string]interface{}{
+						"s": inbound.Seq,
+						"r": req.RoundID,
+						"d": req.DropID,
+						"e": err.Error(),
+					},
+				}))
+				continue
+			}
+			if !s.verifySign(claims.UserID, claims.SessionID, req.RoundID, req.DropID, req.ClientTS, req.Nonce, req.Sign) {
 				respType := "click_result"
 				if inbound.Type == "c" {
 					respType = "cr"
@@ -165,7 +189,23 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 				}))
 				continue
 			}
-			delta, total, isBomb, err := s.processClick(context.Background(), claims.UserID, req.RoundID, req.DropID, req.ClientTS)
+			if err := s.consumeClickNonce(context.Background(), claims.SessionID, req.RoundID, req.Nonce); err != nil {
+				respType := "click_result"
+				if inbound.Type == "c" {
+					respType = "cr"
+				}
+				client.Send(mustJSON(WSMessage{
+					Type: respType,
+					Data: map[string]interface{}{
+						"s": inbound.Seq,
+						"r": req.RoundID,
+						"d": req.DropID,
+						"e": err.Error(),
+					},
+				}))
+				continue
+			}
+			delta, total, isBomb, err := s.processClick(context.Background(), claims.UserID, req.RoundID, req.DropID, req.ClientTS, &client.clock, &client.lateJoin)
 			if err != nil {
 				respType := "click_result"
 				if inbound.Type == "c" {
@@ -214,7 +254,41 @@ func (s *Server) HandleWS(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func roundStatePayload(round models.Round, slices []game.SliceRuntime, revealSalt string, eligible *bool, onlineCount int, whitelistCount int, userID int64) map[string]interface{} {
+func (s *Server) helloPayload(claims *auth.Claims) map[string]interface{} {
+	signRoundID, signKey := s.currentSignKey(claims.SessionID)
+	return map[string]interface{}{
+		"server_time":     time.Now().UnixMilli(),
+		"sign_key":        signKey,
+		"sign_round_id":   signRoundID,
+		"danmaku_enabled": s.IsDanmakuEnabled(),
+		"user": map[string]interface{}{
+			"id":    claims.UserID,
+			"phone": claims.Phone,
+		},
+	}
+}
+
+// initialRoundState 新连接建立时发送的当前轮次状态，无轮次时返回 nil
+func (s *Server) initialRoundState(userID int64) map[string]interface{} {
+	current := s.Game.GetCurrent()
+	if current == nil {
+		return nil
+	}
+	eligible := s.isWhitelisted(current.Round.ID, userID)
+	// 超过加入截止时间才进场的白名单用户按观战处理
+	denied := eligible && s.lateJoinDenied(context.Background(), current.Round, userID, time.Now().UnixMilli())
+	eligible = eligible && !denied
+	whitelistCount, _ := s.Redis.SCard(context.Background(), whitelistKey(current.Round.ID)).Result()
+	onlineCount := s.onlineCount(context.Background(), current.Round.ID)
+	resp := s.roundStatePayload(current.Round, current, &eligible, onlineCount, int(whitelistCount), userID)
+	if denied {
+		resp["late_join_denied"] = true
+	}
+	return resp
+}
+
+// roundStatePayload rt 为该轮次的运行时（用于下发切片），不下发切片时传 nil
+func (s *Server) roundStatePayload(round models.Round, rt *game.RoundRuntime, eligible *bool, onlineCount int, whitelistCount int, userID int64) map[string]interface{} {
 	resp := map[string]interface{}{
 		"round":       round,
 		"server_time": time.Now().UnixMilli(),
@@ -225,11 +299,14 @@ func roundStatePayload(round models.Round, slices []game.SliceRuntime, revealSal
 	resp["online_count"] = onlineCount
 	resp["whitelist_count"] = whitelistCount
 	if userID > 0 && (eligible == nil || *eligible) && (round.Status == models.RoundRunning || round.Status == models.RoundCountdown || round.Status == models.RoundLocked) {
-		manifests := make([]slicePayload, 0, len(slices))
-		for _, s := range slices {
-			manifests = append(manifests, buildSlicePayload(s.Manifest, revealSalt, userID))
+		resp["slices"] = s.userSlicePayloads(rt, userID)
+	}
+	// 非白名单用户以观战身份看到真实状态，只拿到共享的观战动画切片
+	if eligible != nil && !*eligible {
+		resp["spectator"] = true
+		if rt != nil && len(rt.Slices) > 0 && roundInPlay(round.Status) {
+			resp["spectator_slices"] = s.spectatorSlices(rt)
 		}
-		resp["slices"] = manifests
 	}
 	return resp
 }
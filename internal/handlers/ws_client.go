@@ -1,13 +1,24 @@
 package handlers
 
 import (
+	"time"
+
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// 服务端 ping 间隔，用于测量 RTT
+	wsPingInterval = 5 * time.Second
+	wsWriteWait    = 5 * time.Second
+)
+
 type WSClient struct {
 	UserID int64
 	Conn   *websocket.Conn
 	SendCh chan []byte
+
+	clock    clockEstimator
+	lateJoin lateJoinCache
 }
 
 func NewWSClient(userID int64, conn *websocket.Conn) *WSClient {
@@ -26,10 +37,31 @@ func (c *WSClient) Send(payload []byte) {
 	}
 }
 
+// WritePump 串行写出消息，并定期发送 ping（浏览器自动回 pong，由读循环计算 RTT）
 func (c *WSClient) WritePump() {
-	for msg := range c.SendCh {
-		if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			return
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	if err := c.writePing(); err != nil {
+		return
+	}
+	for {
+		select {
+		case msg, ok := <-c.SendCh:
+			if !ok {
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.writePing(); err != nil {
+				return
+			}
 		}
 	}
 }
+
+func (c *WSClient) writePing() error {
+	now := time.Now()
+	return c.Conn.WriteControl(websocket.PingMessage, c.clock.nextPing(now.UnixMilli()), now.Add(wsWriteWait))
+}
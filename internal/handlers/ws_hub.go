@@ -7,12 +7,14 @@ import (
 type Hub struct {
 	mu       sync.RWMutex
 	clients  map[int64]map[*WSClient]bool
+	screens  map[*WSClient]bool
 	broadcast chan []byte
 }
 
 func NewHub() *Hub {
 	return &Hub{
 		clients:  make(map[int64]map[*WSClient]bool),
+		screens:  make(map[*WSClient]bool),
 		broadcast: make(chan []byte, 128),
 	}
 }
@@ -70,3 +72,30 @@ func (h *Hub) UserIDs() []int64 {
 	}
 	return ids
 }
+
+// RegisterScreen 注册大屏展示连接，大屏不计入在线用户
+func (h *Hub) RegisterScreen(client *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.screens[client] = true
+}
+
+func (h *Hub) UnregisterScreen(client *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.screens, client)
+}
+
+func (h *Hub) BroadcastScreens(payload []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.screens {
+		client.Send(payload)
+	}
+}
+
+func (h *Hub) ScreenCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.screens)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// 单个 XML 部件解压后的上限，防止压缩炸弹
+	maxXLSXPartBytes = 64 << 20
+	// 读取的列数上限，导入只用到前几列（手机号、姓名、部门、工号、标签），更靠右的单元格忽略
+	maxXLSXColumns = 16
+	// Excel 的最大列数（XFD），更大的列引用按越界处理
+	xlsxColumnLimit = 16384
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText 共享字符串与内联字符串：纯文本或富文本片段
+type xlsxText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.R) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Index int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// isXLSX 按 zip 文件头判断
+func isXLSX(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// readXLSXRows 读取工作簿第一个工作表的单元格文本，返回的行下标与表格行号对齐（第 i 项为第 i+1 行）
+func readXLSXRows(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("invalid xlsx")
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return errors.New("invalid xlsx: missing " + name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return errors.New("invalid xlsx")
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(io.LimitReader(rc, maxXLSXPartBytes)).Decode(v); err != nil {
+			return errors.New("invalid xlsx: " + name)
+		}
+		return nil
+	}
+
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var wb xlsxWorkbook
+	var rels xlsxRels
+	if decode("xl/workbook.xml", &wb) == nil && decode("xl/_rels/workbook.xml.rels", &rels) == nil && len(wb.Sheets) > 0 {
+		for _, rel := range rels.Items {
+			if rel.ID != wb.Sheets[0].RID {
+				continue
+			}
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", rel.Target)
+			}
+			break
+		}
+	}
+
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		shared = make([]string, len(sst.Items))
+		for i, si := range sst.Items {
+			shared[i] = si.String()
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := decode(sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0, min(len(sheet.Rows), maxWhitelistImportRows+1))
+	for _, row := range sheet.Rows {
+		// 行号与行数都不能超过导入上限（含表头），避免按伪造的行号补齐时无限分配
+		if row.Index > maxWhitelistImportRows+1 || len(rows) >= maxWhitelistImportRows+1 {
+			return nil, fmt.Errorf("too many rows (max %d)", maxWhitelistImportRows)
+		}
+		// 空行不会写入文件，按行号补齐
+		for row.Index > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+		record := make([]string, 0, min(len(row.Cells), maxXLSXColumns))
+		for _, cell := range row.Cells {
+			col := xlsxColumn(cell.Ref)
+			if col >= maxXLSXColumns || (col < 0 && len(record) >= maxXLSXColumns) {
+				continue
+			}
+			for col > len(record) {
+				record = append(record, "")
+			}
+			var text string
+			switch cell.Type {
+			case "s":
+				if i, err := strconv.Atoi(cell.Value); err == nil && i >= 0 && i < len(shared) {
+					text = shared[i]
+				}
+			case "inlineStr":
+				text = cell.Inline.String()
+			case "", "n":
+				// 长数字（如手机号）可能以科学计数法保存
+				text = cell.Value
+				if strings.ContainsAny(text, "eE") {
+					if f, err := strconv.ParseFloat(text, 64); err == nil {
+						text = strconv.FormatFloat(f, 'f', -1, 64)
+					}
+				}
+			default:
+				text = cell.Value
+			}
+			record = append(record, text)
+		}
+		rows = append(rows, record)
+	}
+	return rows, nil
+}
+
+// xlsxColumn 单元格引用（如 "C12"）的列下标，从 0 开始，无法解析时返回 -1，超过 Excel 列上限时返回 xlsxColumnLimit
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		if col > xlsxColumnLimit {
+			return xlsxColumnLimit
+		}
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -19,39 +19,70 @@ const (
 	RoundLocked         RoundStatus = "LOCKED"
 	RoundCountdown      RoundStatus = "COUNTDOWN"
 	RoundRunning        RoundStatus = "RUNNING"
+	RoundPaused         RoundStatus = "PAUSED"
 	RoundReadyDraw      RoundStatus = "READY_DRAW"
 	RoundDrawing        RoundStatus = "DRAWING"
 	RoundPendingConfirm RoundStatus = "PENDING_CONFIRM"
 	RoundFinished       RoundStatus = "FINISHED"
+	RoundAborted        RoundStatus = "ABORTED"
 )
 
 type Round struct {
-	ID            int64       `json:"id"`
-	Title         string      `json:"title"`
-	TotalPool     int64       `json:"total_pool"` // 分
-	DurationSec   int         `json:"duration_sec"`
-	SliceMS       int         `json:"slice_ms"`
-	DropsPerSlice int         `json:"drops_per_slice"`
-	BombsPerSlice int         `json:"bombs_per_slice"`
-	BigsPerSlice  int         `json:"bigs_per_slice"`
-	EmptyPerSlice int         `json:"empty_per_slice"`
-	BigMultiplier float64     `json:"big_multiplier"`
-	MaxSpeed      float64     `json:"max_speed"`
-	DropVisibleMS int         `json:"drop_visible_ms"`
-	ScoreTotal    int         `json:"score_total"` // 每用户总幸运分
-	BombPenalty   int         `json:"bomb_penalty"`
-	MinAward      int64       `json:"min_award"`
-	MaxAward      int64       `json:"max_award"`
-	LuckyRatio    int         `json:"lucky_ratio"`
-	BaseRatio     int         `json:"base_ratio"`
-	TailTopN      int         `json:"tail_top_n"`
-	RankSegments  int         `json:"rank_segments"`
-	Status        RoundStatus `json:"status"`
-	StartAtMS     int64       `json:"start_at"`
-	EndAtMS       int64       `json:"end_at"`
-	Seed          uint32      `json:"seed"`
-	CreatedAt     time.Time   `json:"created_at"`
-	UpdatedAt     time.Time   `json:"updated_at"`
+	ID                    int64       `json:"id"`
+	Title                 string      `json:"title"`
+	TotalPool             int64       `json:"total_pool"` // 分
+	DurationSec           int         `json:"duration_sec"`
+	SliceMS               int         `json:"slice_ms"`
+	DropsPerSlice         int         `json:"drops_per_slice"`
+	BombsPerSlice         int         `json:"bombs_per_slice"`
+	BigsPerSlice          int         `json:"bigs_per_slice"`
+	EmptyPerSlice         int         `json:"empty_per_slice"`
+	BigMultiplier         float64     `json:"big_multiplier"`
+	MaxSpeed              float64     `json:"max_speed"`
+	DropVisibleMS         int         `json:"drop_visible_ms"`
+	ScoreTotal            int         `json:"score_total"` // 每用户总幸运分
+	BombPenalty           int         `json:"bomb_penalty"`
+	MinAward              int64       `json:"min_award"`
+	MaxAward              int64       `json:"max_award"`
+	LuckyRatio            int         `json:"lucky_ratio"`
+	BaseRatio             int         `json:"base_ratio"`
+	TailTopN              int         `json:"tail_top_n"`
+	RankSegments          int         `json:"rank_segments"`
+	LeaderboardIntervalMS int         `json:"leaderboard_interval_ms"` // 实时排行榜推送间隔
+	LeaderboardTopN       int         `json:"leaderboard_top_n"`
+	TemplateID            int64       `json:"template_id,omitempty"` // 创建时使用的模板
+	TeamMode              string      `json:"team_mode"`             // 空为个人赛，DEPARTMENT / RANDOM 为团队赛
+	TeamCount             int         `json:"team_count"`            // RANDOM 模式的队伍数
+	TeamRatio             int         `json:"team_ratio"`            // 团队奖池占总奖池的百分比
+	TeamTopN              int         `json:"team_top_n"`            // 瓜分团队奖池的前 N 名队伍
+	LateJoin              string      `json:"late_join"`             // 中途加入策略：ALLOW / DENY / PRORATE
+	LateJoinSec           int         `json:"late_join_sec"`         // DENY 模式下开始后允许加入的秒数
+	Status                RoundStatus `json:"status"`
+	StartAtMS             int64       `json:"start_at"`
+	EndAtMS               int64       `json:"end_at"`
+	PausedAtMS            int64       `json:"paused_at,omitempty"` // 暂停时刻，恢复时据此顺延；未暂停为 0
+	Seed                  uint32      `json:"seed"`
+	AbortReason           string      `json:"abort_reason,omitempty"`
+	CreatedAt             time.Time   `json:"created_at"`
+	UpdatedAt             time.Time   `json:"updated_at"`
+}
+
+// AgendaItem 议程中的一轮：按时锁定、开始，并可自动开奖与确认
+type AgendaItem struct {
+	ID           int64       `json:"id"`
+	RoundID      int64       `json:"round_id"`
+	RoundTitle   string      `json:"round_title"`
+	RoundStatus  RoundStatus `json:"round_status"`
+	LockAtMS     int64       `json:"lock_at"`
+	StartAtMS    int64       `json:"start_at"`
+	CountdownSec int         `json:"countdown_sec"`
+	AutoDraw     bool        `json:"auto_draw"`
+	AutoConfirm  bool        `json:"auto_confirm"`
+	Status       string      `json:"status"`
+	LastStep     string      `json:"last_step"`
+	LastError    string      `json:"last_error"`
+	Operator     string      `json:"operator"`
+	UpdatedAt    time.Time   `json:"updated_at"`
 }
 
 type AwardBatch struct {
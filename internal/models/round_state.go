@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidRoundTransition 状态机不允许的迁移
+var ErrInvalidRoundTransition = errors.New("invalid round status transition")
+
+// RoundTransitionGuard 迁移前置条件，r 为迁移时（已带上新字段值）的轮次
+type RoundTransitionGuard func(r Round) error
+
+func allowAlways(Round) error { return nil }
+
+func requireSchedule(r Round) error {
+	if r.StartAtMS <= 0 || r.EndAtMS <= r.StartAtMS {
+		return errors.New("round schedule not set")
+	}
+	return nil
+}
+
+func requireEnded(r Round) error {
+	if time.Now().UnixMilli() < r.EndAtMS {
+		return errors.New("round still running")
+	}
+	return nil
+}
+
+func requireAbortReason(r Round) error {
+	if r.AbortReason == "" {
+		return errors.New("abort reason required")
+	}
+	return nil
+}
+
+// roundTransitions 轮次状态机：from -> to -> guard
+var roundTransitions = map[RoundStatus]map[RoundStatus]RoundTransitionGuard{
+	RoundWaiting: {
+		RoundLocked: allowAlways,
+	},
+	RoundLocked: {
+		RoundCountdown: requireSchedule,
+		RoundAborted:   requireAbortReason,
+	},
+	RoundCountdown: {
+		RoundRunning: allowAlways,
+		RoundAborted: requireAbortReason,
+	},
+	RoundRunning: {
+		RoundPaused:    allowAlways,
+		RoundReadyDraw: allowAlways,
+		RoundDrawing:   requireEnded,
+		RoundAborted:   requireAbortReason,
+	},
+	RoundPaused: {
+		RoundRunning:   allowAlways,
+		RoundReadyDraw: allowAlways,
+		RoundAborted:   requireAbortReason,
+	},
+	RoundReadyDraw: {
+		RoundDrawing: allowAlways,
+		RoundAborted: requireAbortReason,
+	},
+	RoundDrawing: {
+		RoundPendingConfirm: allowAlways,
+		RoundReadyDraw:      allowAlways, // 开奖失败或批次作废
+	},
+	RoundPendingConfirm: {
+		RoundFinished:  allowAlways,
+		RoundReadyDraw: allowAlways, // 批次作废后重新开奖
+	},
+}
+
+// CheckRoundTransition 校验 r.Status -> to 是否允许并执行前置条件
+func CheckRoundTransition(r Round, to RoundStatus) error {
+	guard, ok := roundTransitions[r.Status][to]
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidRoundTransition, r.Status, to)
+	}
+	if err := guard(r); err != nil {
+		return fmt.Errorf("%w: %s -> %s: %v", ErrInvalidRoundTransition, r.Status, to, err)
+	}
+	return nil
+}
+
+// RoundStatusHistory 轮次状态迁移记录
+type RoundStatusHistory struct {
+	ID         int64       `json:"id"`
+	RoundID    int64       `json:"round_id"`
+	FromStatus RoundStatus `json:"from_status"`
+	ToStatus   RoundStatus `json:"to_status"`
+	Actor      string      `json:"actor"`
+	Reason     string      `json:"reason"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
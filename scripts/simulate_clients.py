@@ -172,6 +172,7 @@ class SimClient:
         self.poll_task: Optional[asyncio.Task] = None
         self.ws_task: Optional[asyncio.Task] = None
         self.ping_task: Optional[asyncio.Task] = None
+        self.ws_rtt_ms = 0
         self.click_task: Optional[asyncio.Task] = None
 
         self.server_offset_ms = 0
@@ -189,6 +190,8 @@ class SimClient:
         self.max_reconnect_delay_ms = 8000
         self.sign_key_hex = ""
         self.sign_key_bytes: Optional[bytes] = None
+        self.sign_round_id = 0
+        self.click_nonce = 0
         self.burst_task: Optional[asyncio.Task] = None
         self.burst_drop_ids: List[int] = []
         self.burst_idx = 0
@@ -229,14 +232,15 @@ class SimClient:
             self.reconnect_delay_ms = min(self.max_reconnect_delay_ms, int(self.reconnect_delay_ms * 1.5))
 
     async def ping_loop(self) -> None:
+        # 首次立即 ping，服务端据此估计时钟偏移用于点击时间判定
         while True:
-            await asyncio.sleep(8)
             if not self.ws or self.ws.closed:
                 break
             try:
-                await self.ws.send_json({"type": "ping", "ts": now_ms()})
+                await self.ws.send_json({"type": "ping", "ts": now_ms(), "rtt": self.ws_rtt_ms})
             except Exception:
                 break
+            await asyncio.sleep(8)
 
     async def ws_loop(self) -> None:
         if self.ws is None:
@@ -255,7 +259,7 @@ class SimClient:
         if msg_type == "hello":
             data = msg.get("data", {}) or {}
             self.sync_offset(data.get("server_time"))
-            self.update_sign_key(data.get("sign_key"))
+            self.update_sign_key(data.get("sign_key"), data.get("sign_round_id"))
             return
         if msg_type == "pong":
             data = msg.get("data", {}) or {}
@@ -266,6 +270,20 @@ class SimClient:
             self.sync_offset(data.get("server_time"))
             await self.apply_round_state(data)
             return
+        if msg_type == "round_slices":
+            data = msg.get("data", {}) or {}
+            round_id = int(data.get("round_id") or 0)
+            if round_id != self.round_id:
+                self.reset_round(round_id)
+            self.update_sign_key(data.get("sign_key"), data.get("sign_round_id"))
+            if data.get("slices"):
+                self.slices = data.get("slices") or []
+                if not self.schedule_ready:
+                    if self.click_mode == "burst":
+                        self.build_burst_targets()
+                    else:
+                        self.build_schedule()
+            return
         if msg_type == "clear_screen":
             self.reset_round(0)
             return
@@ -300,6 +318,7 @@ class SimClient:
         rtt = recv - sent
         if rtt < 0:
             rtt = 0
+        self.ws_rtt_ms = rtt
         midpoint = sent + (rtt // 2)
         new_offset = int(server_time) - midpoint
         if self.server_offset_ms == 0:
@@ -317,7 +336,7 @@ class SimClient:
             alpha = 0.1
         self.server_offset_ms = int(self.server_offset_ms + alpha * (new_offset - self.server_offset_ms))
 
-    def update_sign_key(self, key_hex: Optional[str]) -> None:
+    def update_sign_key(self, key_hex: Optional[str], round_id: Optional[int] = None) -> None:
         if not key_hex:
             return
         if key_hex == self.sign_key_hex:
@@ -330,6 +349,7 @@ class SimClient:
             return
         self.sign_key_hex = str(key_hex)
         self.sign_key_bytes = raw
+        self.sign_round_id = int(round_id or 0)
 
     async def api_request(
         self, method: str, path: str, json_body: Optional[Dict] = None, expect_json: bool = True
@@ -379,7 +399,7 @@ class SimClient:
         round_cfg = data.get("round")
         if not round_cfg:
             return
-        self.update_sign_key(data.get("sign_key"))
+        self.update_sign_key(data.get("sign_key"), data.get("sign_round_id"))
         new_round_id = int(round_cfg.get("id") or 0)
         if new_round_id != self.round_id:
             self.reset_round(new_round_id)
@@ -493,30 +513,31 @@ class SimClient:
                 return
             await asyncio.sleep(min(0.2, diff / 1000.0))
 
-    def make_sign(self, round_id: int, drop_id: int, client_ts: int) -> str:
+    def make_sign(self, round_id: int, drop_id: int, client_ts: int, nonce: int) -> str:
         key = None
-        if self.sign_key_bytes:
+        if self.sign_key_bytes and self.sign_round_id == round_id:
             key = self.sign_key_bytes
         elif self.sign_secret:
             key = self.sign_secret.encode()
         else:
             return ""
-        msg = f"{self.user_id}|{round_id}|{drop_id}|{client_ts}".encode()
+        msg = f"{self.user_id}|{round_id}|{drop_id}|{client_ts}|{nonce}".encode()
         return hmac.new(key, msg, hashlib.sha256).hexdigest()
 
     async def send_click(self, drop: Drop) -> None:
         if not self.round_id:
             return
-        if self.server_offset_ms:
-            client_ts = now_ms() + self.server_offset_ms
-        else:
-            client_ts = now_ms()
+        # 与浏览器一致：client_ts 使用本地时钟，服务端按 ping 估计的偏移换算
+        client_ts = now_ms()
+        # nonce 会话内严格递增
+        self.click_nonce = max(self.click_nonce + 1, client_ts)
         payload = {
             "round_id": self.round_id,
             "drop_id": drop.drop_id,
             "client_ts": client_ts,
+            "nonce": self.click_nonce,
         }
-        payload["sign"] = self.make_sign(self.round_id, drop.drop_id, client_ts)
+        payload["sign"] = self.make_sign(self.round_id, drop.drop_id, client_ts, self.click_nonce)
         if not payload["sign"]:
             return
         if self.ws_connected and self.ws and not self.ws.closed:
@@ -527,6 +548,7 @@ class SimClient:
                         "r": payload["round_id"],
                         "d": payload["drop_id"],
                         "t": payload["client_ts"],
+                        "n": payload["nonce"],
                         "s": payload["sign"],
                     },
                 }))